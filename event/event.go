@@ -0,0 +1,136 @@
+// Package event provides an in-process bus of simulator events.
+package event
+
+import (
+	"sync"
+	"time"
+)
+
+// Type identifies the kind of an event.
+type Type string
+
+// Event types
+const (
+	SessionOpened    Type = "session_opened"
+	SessionBound     Type = "session_bound"
+	SessionClosed    Type = "session_closed"
+	FrameReceived    Type = "frame_received"
+	FrameSent        Type = "frame_sent"
+	MessageAccepted  Type = "message_accepted"
+	NotificationSent Type = "notification_sent"
+	MOSent           Type = "mo_sent"
+	// Snapshot is a periodic aggregate of the simulator state
+	Snapshot Type = "snapshot"
+	// Dropped tells a subscriber that had fallen behind how many events it missed
+	Dropped Type = "dropped"
+)
+
+// Event is something that happened in the simulator.
+type Event struct {
+	Type Type        `json:"type"`
+	Time time.Time   `json:"time"`
+	Data interface{} `json:"data"`
+}
+
+// Session is the data of the session events.
+type Session struct {
+	ID         string `json:"id"`
+	Profile    string `json:"profile"`
+	RemoteAddr string `json:"remote_addr"`
+	Account    string `json:"account"`
+}
+
+// Frame is the data of the frame events.
+type Frame struct {
+	Session   string `json:"session"`
+	TRN       string `json:"trn"`
+	Type      string `json:"type"`
+	Operation string `json:"operation"`
+	Frame     string `json:"frame"`
+}
+
+// Message is the data of a MessageAccepted event.
+type Message struct {
+	ID        string  `json:"id"`
+	Session   string  `json:"session"`
+	Account   string  `json:"account"`
+	Operation string  `json:"operation"`
+	Sender    string  `json:"sender"`
+	Recipient string  `json:"recipient"`
+	Message   string  `json:"message"`
+	Cost      float64 `json:"cost"`
+}
+
+// Notification is the data of a NotificationSent event.
+type Notification struct {
+	ID        string `json:"id"`
+	Session   string `json:"session"`
+	Recipient string `json:"recipient"`
+	Status    string `json:"status"`
+	Reason    string `json:"reason"`
+}
+
+// MO is the data of a MOSent event.
+type MO struct {
+	Session   string `json:"session"`
+	Sender    string `json:"sender"`
+	Recipient string `json:"recipient"`
+}
+
+// Gap is the data of a Dropped event.
+type Gap struct {
+	// Count is the number of events missed since the previous event received
+	Count int `json:"count"`
+}
+
+// bufferSize is the number of events a subscriber may fall behind before it misses events.
+const bufferSize = 1024
+
+var bus = struct {
+	sync.Mutex
+	// subs are the subscriber channels with the number of events each missed since it last had room
+	subs map[chan Event]int
+}{subs: make(map[chan Event]int)}
+
+// Publish sends an event to every subscriber.
+// A subscriber that has fallen behind misses the event rather than slowing down the simulator,
+// and once it has room again receives a Dropped event with the number of events it missed.
+func Publish(t Type, data interface{}) {
+	e := Event{Type: t, Time: time.Now(), Data: data}
+	bus.Lock()
+	defer bus.Unlock()
+	for ch, dropped := range bus.subs {
+		if dropped > 0 {
+			select {
+			case ch <- Event{Type: Dropped, Time: e.Time, Data: Gap{Count: dropped}}:
+				dropped = 0
+			default:
+				bus.subs[ch] = dropped + 1
+				continue
+			}
+		}
+		select {
+		case ch <- e:
+		default:
+			dropped++
+		}
+		bus.subs[ch] = dropped
+	}
+}
+
+// Subscribe returns a channel receiving every published event and a function that cancels the subscription.
+func Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, bufferSize)
+	bus.Lock()
+	bus.subs[ch] = 0
+	bus.Unlock()
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			bus.Lock()
+			delete(bus.subs, ch)
+			bus.Unlock()
+			close(ch)
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package event
+
+import "testing"
+
+func TestPublishDropped(t *testing.T) {
+	tests := []struct {
+		name      string
+		published int
+		dropped   int
+	}{
+		{"buffered", bufferSize, 0},
+		{"one missed", bufferSize + 1, 1},
+		{"many missed", bufferSize + 100, 100},
+	}
+	for _, tt := range tests {
+		slow, cancel := Subscribe()
+		for i := 0; i < tt.published; i++ {
+			Publish(MOSent, i)
+		}
+		for i := 0; i < bufferSize; i++ {
+			if e := <-slow; e.Data != i {
+				t.Fatalf("%s: event %d has data %v", tt.name, i, e.Data)
+			}
+		}
+		Publish(MOSent, "next")
+		if tt.dropped > 0 {
+			e := <-slow
+			if e.Type != Dropped || e.Data != (Gap{Count: tt.dropped}) {
+				t.Errorf("%s: got %s %v, want %s %v", tt.name, e.Type, e.Data, Dropped, Gap{Count: tt.dropped})
+			}
+		}
+		if e := <-slow; e.Data != "next" {
+			t.Errorf("%s: got %s %v after the gap, want the next event", tt.name, e.Type, e.Data)
+		}
+		cancel()
+	}
+}
+
+func TestPublishSlowSubscriber(t *testing.T) {
+	slow, cancelSlow := Subscribe()
+	defer cancelSlow()
+	fast, cancelFast := Subscribe()
+	defer cancelFast()
+	for i := 0; i < bufferSize*2; i++ {
+		Publish(MOSent, i)
+		if e := <-fast; e.Type != MOSent || e.Data != i {
+			t.Fatalf("fast subscriber got %s %v, want %s %d", e.Type, e.Data, MOSent, i)
+		}
+	}
+	if n := len(slow); n != bufferSize {
+		t.Errorf("slow subscriber has %d events buffered, want %d", n, bufferSize)
+	}
+}
@@ -0,0 +1,160 @@
+package server
+
+import (
+	"crypto/tls"
+	"log"
+	"math/rand"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Chaos is a connection-level fault applied to a session.
+type Chaos string
+
+const (
+	// ChaosClose closes the connection
+	ChaosClose Chaos = "close"
+	// ChaosReset closes the connection with a TCP RST
+	ChaosReset Chaos = "reset"
+	// ChaosStall stops reading from the connection
+	ChaosStall Chaos = "stall"
+	// ChaosResume resumes reading from a stalled connection
+	ChaosResume Chaos = "resume"
+	// ChaosCorrupt writes the next frame with a wrong checksum
+	ChaosCorrupt Chaos = "corrupt"
+	// ChaosTruncate writes only the first half of the next frame
+	ChaosTruncate Chaos = "truncate"
+)
+
+var randomChaos = []Chaos{ChaosClose, ChaosReset, ChaosStall, ChaosCorrupt, ChaosTruncate}
+
+// knownChaos returns the chaos actions that exist and an error naming the others.
+func knownChaos(actions []string) ([]string, error) {
+	known := make([]string, 0, len(actions))
+	var unknown []string
+	for _, a := range actions {
+		switch Chaos(a) {
+		case ChaosClose, ChaosReset, ChaosStall, ChaosResume, ChaosCorrupt, ChaosTruncate:
+			known = append(known, a)
+		default:
+			unknown = append(unknown, strconv.Quote(a))
+		}
+	}
+	if len(unknown) > 0 {
+		return known, errors.Errorf("Unknown chaos actions %s", strings.Join(unknown, ", "))
+	}
+	return known, nil
+}
+
+// chaosConn is a connection that can mangle the frames written to it.
+type chaosConn struct {
+	net.Conn
+	mu     sync.Mutex
+	next   Chaos
+	frames int64
+}
+
+// sent returns the number of frames written to the connection.
+func (c *chaosConn) sent() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.frames
+}
+
+func (c *chaosConn) arm(action Chaos) {
+	c.mu.Lock()
+	c.next = action
+	c.mu.Unlock()
+}
+
+// Write writes the frame, corrupting or truncating it if armed to.
+func (c *chaosConn) Write(b []byte) (int, error) {
+	c.mu.Lock()
+	action := c.next
+	c.next = ""
+	c.frames++
+	c.mu.Unlock()
+	frame := b
+	switch action {
+	case ChaosCorrupt:
+		if len(b) > 3 {
+			frame = append([]byte{}, b...)
+			frame[len(frame)-3] ^= 0x01
+		}
+	case ChaosTruncate:
+		frame = b[:len(b)/2]
+	}
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// reset closes the connection without lingering so that the peer receives a RST.
+func (c *chaosConn) reset() error {
+	conn := c.Conn
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn = tc.NetConn()
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetLinger(0)
+	}
+	return conn.Close()
+}
+
+// Disrupt applies a connection-level fault to the session with the given id.
+// Stalls last for the given duration, or until resumed if zero.
+func Disrupt(id string, action Chaos, d time.Duration) error {
+	s := sessions.get(id)
+	if s == nil {
+		return errors.Errorf("Session %s not found", id)
+	}
+	return s.disrupt(action, d)
+}
+
+func (s *session) disrupt(action Chaos, d time.Duration) error {
+	switch action {
+	case ChaosClose:
+		return s.conn.Close()
+	case ChaosReset:
+		return s.conn.reset()
+	case ChaosStall:
+		if d == 0 {
+			d = 24 * time.Hour
+		}
+		s.stall(time.Now().Add(d))
+	case ChaosResume:
+		s.stall(time.Time{})
+	case ChaosCorrupt, ChaosTruncate:
+		s.conn.arm(action)
+	default:
+		return errors.Errorf("Unknown action %s", action)
+	}
+	return nil
+}
+
+// maybeDisrupt fires a random connection-level fault at the configured rate.
+func (s *session) maybeDisrupt(rate float64, actions []string, stall time.Duration) {
+	if rand.Float64()*100 >= rate {
+		return
+	}
+	choices := randomChaos
+	if len(actions) > 0 {
+		choices = make([]Chaos, len(actions))
+		for i, a := range actions {
+			choices[i] = Chaos(a)
+		}
+	}
+	if stall == 0 {
+		// a random stall must end by itself
+		stall = 10 * time.Second
+	}
+	if err := s.disrupt(choices[rand.Intn(len(choices))], stall); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// WriteMetrics writes the number of open sessions per profile and account in the Prometheus text format.
+// Sessions that have not authenticated are counted with an empty account.
+func WriteMetrics(w io.Writer) {
+	type key struct{ profile, account string }
+	counts := make(map[key]int)
+	for _, s := range Sessions() {
+		counts[key{s.Profile, s.Account}]++
+	}
+	keys := make([]key, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].profile != keys[j].profile {
+			return keys[i].profile < keys[j].profile
+		}
+		return keys[i].account < keys[j].account
+	})
+	fmt.Fprintln(w, "# HELP ucp_sessions Open client sessions.")
+	fmt.Fprintln(w, "# TYPE ucp_sessions gauge")
+	for _, k := range keys {
+		fmt.Fprintf(w, "ucp_sessions{profile=%q,account=%q} %d\n", k.profile, k.account, counts[k])
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"log"
+	"net"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/ucp"
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+const maxBackoff = time.Minute
+
+// dialOutbound keeps a connection to the client endpoint open, reconnecting with exponential backoff.
+func dialOutbound(o util.Outbound, profile util.Profile) {
+	backoff := time.Second
+	for {
+		bound, err := runOutbound(o, profile)
+		if bound {
+			backoff = time.Second
+		}
+		log.Printf("Outbound connection to %s failed, reconnecting in %s: %v", o.Addr, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// runOutbound connects and authenticates to the client endpoint, then serves the connection until it fails.
+func runOutbound(o util.Outbound, profile util.Profile) (bool, error) {
+	conn, err := net.DialTimeout("tcp", o.Addr, 10*time.Second)
+	if err != nil {
+		return false, err
+	}
+	s := newSession(&chaosConn{Conn: conn}, profile)
+	s.outbound = true
+	defer conn.Close()
+	uc := s.uc
+	user := o.User
+	if user == "" {
+		user = profile.AccessCode
+	}
+	if _, err := uc.Write(ucp.Login(1, user, o.Password)); err != nil {
+		return false, err
+	}
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	res, err := ucp.New(uc)
+	if err != nil {
+		return false, err
+	}
+	conn.SetReadDeadline(time.Time{})
+	if string(res.Type) != "R" || len(res.Data) == 0 || res.Data[0] != 'A' {
+		return false, errors.Errorf("Login rejected: %s", res)
+	}
+	uc.Bind(o.Account)
+	sessions.add(s)
+	ucp.AddOutbound(uc)
+	defer func() {
+		ucp.RemoveOutbound(uc)
+		sessions.remove(s)
+	}()
+	log.Printf("Outbound connection to %s bound as %s", o.Addr, user)
+	for {
+		pdu, err := ucp.New(uc)
+		if err != nil {
+			return true, err
+		}
+		s.received(string(pdu.Operation))
+		switch string(pdu.Type) {
+		case "O":
+			pdu.Decode(profile)
+			pdu.Stats()
+		case "R":
+			if len(pdu.Data) > 0 && pdu.Data[0] == 'N' {
+				log.Printf("Outbound %s operation %s rejected: %s", o.Addr, pdu.Operation, pdu.Data)
+			}
+			pdu.Decode(profile)
+		}
+	}
+}
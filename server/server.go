@@ -2,75 +2,179 @@
 package server
 
 import (
+	"crypto/tls"
+	stderrors "errors"
 	"fmt"
 	"log"
 	"net"
 	"sync"
+	"time"
 
+	"github.com/jcaberio/ucp-smsc-sim/event"
 	"github.com/jcaberio/ucp-smsc-sim/ucp"
 	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
 )
 
-var cl = &connList{
-	conns: make([]net.Conn, 0),
-}
-
-// Start starts the UCP server with the following configuration.
+// Start starts a UCP server for each listener of the configuration.
 func Start(config util.Config) {
-	port := fmt.Sprintf(":%d", config.Port)
-	ln, err := net.Listen("tcp", port)
-
-	if err != nil {
+	var wg sync.WaitGroup
+	serve := func(ln net.Listener, listener util.Listener) {
+		log.Printf("Serving profile %q on %s", listener.Name, ln.Addr())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var backoff time.Duration
+			for {
+				conn, err := ln.Accept()
+				if err != nil {
+					// back off on temporary errors such as running out of file descriptors
+					if ne, ok := err.(net.Error); ok && ne.Temporary() {
+						if backoff == 0 {
+							backoff = 5 * time.Millisecond
+						} else if backoff *= 2; backoff > time.Second {
+							backoff = time.Second
+						}
+						log.Printf("Accepting on %s failed, retrying in %v: %v", ln.Addr(), backoff, err)
+						time.Sleep(backoff)
+						continue
+					}
+					if !stderrors.Is(err, net.ErrClosed) {
+						log.Println(err)
+					}
+					return
+				}
+				backoff = 0
+				go handleConnection(conn, listener)
+			}
+		}()
+	}
+	if config.Subscribers != "" {
+		if err := ucp.LoadSubscribers(config.Subscribers); err != nil {
+			log.Println(err)
+		}
+	}
+	if err := ucp.OpenCDRs(config.CDR); err != nil {
 		log.Println(err)
 	}
-	for {
-		conn, err := ln.Accept()
+	ucp.InitTrafficLog(config.TrafficLog)
+	ucp.InitMessageStore(config.MessageRetention)
+	go broadcast()
+	for _, listener := range config.Listeners {
+		if err := ucp.CheckDNTemplates(listener.DNTemplates); err != nil {
+			log.Printf("Profile %q: %v", listener.Name, err)
+		}
+		actions, err := knownChaos(listener.ChaosActions)
 		if err != nil {
-			log.Println(err)
+			// an unknown action would only fail when it is drawn, so it is left out
+			log.Printf("Profile %q: %v", listener.Name, err)
+			if len(actions) == 0 {
+				// no actions would mean all of them
+				listener.ChaosRate = 0
+			}
+			listener.ChaosActions = actions
+		}
+		ucp.InitBalances(listener.Profile)
+		for _, o := range listener.Outbound {
+			go dialOutbound(o, listener.Profile)
+		}
+		if listener.Port != 0 {
+			ln, err := net.Listen("tcp", fmt.Sprintf(":%d", listener.Port))
+			if err != nil {
+				log.Println(err)
+			} else {
+				serve(ln, listener)
+			}
+		}
+		if listener.TLS.Port != 0 {
+			ln, err := listenTLS(listener.TLS)
+			if err != nil {
+				log.Println(err)
+			} else {
+				serve(ln, listener)
+			}
 		}
-		go handleConnection(conn, config)
-
 	}
+	wg.Wait()
 }
 
-func handleConnection(conn net.Conn, config util.Config) {
-	for {
-
-		pdu, err := ucp.New(conn)
+func handleConnection(conn net.Conn, listener util.Listener) {
+	config := listener.Profile
+	s := newSession(&chaosConn{Conn: conn}, config)
+	sessions.add(s)
+	defer func() {
+		sessions.remove(s)
+		conn.Close()
+	}()
+	uc := s.uc
+	if tc, ok := conn.(*tls.Conn); ok {
+		conn.SetDeadline(time.Now().Add(handshakeTimeout))
+		account, err := certAccount(tc)
+		conn.SetDeadline(time.Time{})
 		if err != nil {
+			log.Println(err)
 			return
 		}
-		cl.add(conn)
-		select {
-		case deliverSM := <-ucp.DeliverSMCh:
-			cl.Lock()
-			for _, c := range cl.conns {
-				if c != nil {
-					c.Write(deliverSM.Result())
-				}
+		if _, ok := config.Account(account); ok && listener.TLS.AccountFromCert {
+			uc.Bind(account)
+		}
+	}
+	for {
+		s.wait()
+		if d := s.idleTimeout(config); d > 0 {
+			conn.SetReadDeadline(time.Now().Add(d))
+		}
+		pdu, err := ucp.New(uc)
+		if err != nil {
+			if ne, ok := errors.Cause(err).(net.Error); ok && ne.Timeout() {
+				log.Printf("Closing idle session %s", s.id)
 			}
-			cl.Unlock()
-
-		default:
-			pdu.Decode(config)
-			pdu.Stats()
-
+			return
 		}
+		s.received(string(pdu.Operation))
+		pdu.Decode(config)
+		pdu.Stats()
+		s.maybeDisrupt(config.ChaosRate, config.ChaosActions, time.Duration(config.ChaosStall)*time.Millisecond)
 	}
 }
 
-type connList struct {
-	sync.Mutex
-	conns []net.Conn
-}
+// moWriteTimeout is how long a session may take to accept a Deliver Short Message operation
+// before it is skipped, so that a stalled client does not hold up the others.
+const moWriteTimeout = 5 * time.Second
 
-func (c *connList) add(connToAdd net.Conn) {
-	c.Lock()
-	defer c.Unlock()
-	for _, conn := range c.conns {
-		if conn.RemoteAddr().String() == connToAdd.RemoteAddr().String() {
-			return
+// broadcast sends the Deliver Short Message operations to every outbound connection,
+// or to every bound session if there is none.
+func broadcast() {
+	for deliverSM := range ucp.DeliverSMCh {
+		res := deliverSM.Result()
+		outbound := len(ucp.Outbound()) > 0
+		for _, s := range sessions.list() {
+			if outbound && !s.outbound || !outbound && s.uc.Account() == "" {
+				continue
+			}
+			if _, err := s.uc.WriteTimeout(res, moWriteTimeout); err != nil {
+				log.Println("Writing deliver_sm failed: ", err)
+				// a partly written frame leaves the session unusable
+				if ne, ok := err.(net.Error); ok && ne.Timeout() {
+					s.uc.Close()
+				}
+				continue
+			}
+			ucp.ObserveMO()
+			event.Publish(event.MOSent, event.MO{
+				Session:   s.id,
+				Sender:    string(deliverSM.OAdC),
+				Recipient: string(deliverSM.AdC),
+			})
+			ucp.WriteCDR(ucp.CDR{
+				Type:      ucp.CDRMO,
+				Profile:   s.uc.Profile.Name,
+				Account:   s.uc.Account(),
+				Operation: ucp.DELIVER_SHORT_MESSAGE_OP,
+				OAdC:      string(deliverSM.OAdC),
+				AdC:       string(deliverSM.AdC),
+				Segments:  1,
+			})
 		}
 	}
-	c.conns = append(c.conns, connToAdd)
 }
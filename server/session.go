@@ -0,0 +1,206 @@
+package server
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/event"
+	"github.com/jcaberio/ucp-smsc-sim/ucp"
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+var (
+	sessions = &sessionList{
+		m: make(map[string]*session),
+	}
+	lastID int64
+)
+
+// Session states
+const (
+	StateOpen         = "open"
+	StateBound        = "bound"
+	StateProvisioning = "provisioning"
+	StateStalled      = "stalled"
+	StateOutbound     = "outbound"
+)
+
+// session is a client connection handled by the server.
+type session struct {
+	id          string
+	conn        *chaosConn
+	uc          *ucp.Conn
+	connectedAt time.Time
+	// opened by the server to a client endpoint
+	outbound bool
+	mu       sync.Mutex
+	// reading is paused until this time
+	stalledUntil time.Time
+	lastActivity time.Time
+	// number of operations received by operation type
+	ops map[string]int
+}
+
+func newSession(conn *chaosConn, profile util.Profile) *session {
+	now := time.Now()
+	s := &session{
+		id:           strconv.FormatInt(atomic.AddInt64(&lastID, 1), 10),
+		conn:         conn,
+		uc:           ucp.NewConn(conn),
+		connectedAt:  now,
+		lastActivity: now,
+		ops:          make(map[string]int),
+	}
+	s.uc.ID = s.id
+	s.uc.Profile = profile
+	return s
+}
+
+// idleTimeout returns how long the session may go without an incoming operation.
+func (s *session) idleTimeout(config util.Profile) time.Duration {
+	secs := config.IdleTimeout
+	if acc, ok := config.Account(s.uc.Account()); ok && acc.IdleTimeout > 0 {
+		secs = acc.IdleTimeout
+	}
+	return time.Duration(secs) * time.Second
+}
+
+// received records an incoming operation.
+func (s *session) received(operation string) {
+	s.mu.Lock()
+	s.lastActivity = time.Now()
+	s.ops[operation]++
+	s.mu.Unlock()
+}
+
+func (s *session) stall(until time.Time) {
+	s.mu.Lock()
+	s.stalledUntil = until
+	s.mu.Unlock()
+}
+
+// wait blocks while the session is stalled.
+func (s *session) wait() {
+	for {
+		s.mu.Lock()
+		until := s.stalledUntil
+		s.mu.Unlock()
+		if !time.Now().Before(until) {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// SessionInfo describes a client session.
+type SessionInfo struct {
+	ID           string         `json:"id"`
+	Profile      string         `json:"profile"`
+	RemoteAddr   string         `json:"remote_addr"`
+	Account      string         `json:"account"`
+	State        string         `json:"state"`
+	ConnectedAt  time.Time      `json:"connected_at"`
+	BoundAt      time.Time      `json:"bound_at"`
+	LastActivity time.Time      `json:"last_activity"`
+	Received     map[string]int `json:"received"`
+	Sent         int64          `json:"sent"`
+}
+
+func (s *session) info() SessionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info := SessionInfo{
+		ID:           s.id,
+		Profile:      s.uc.Profile.Name,
+		RemoteAddr:   s.conn.RemoteAddr().String(),
+		Account:      s.uc.Account(),
+		State:        StateOpen,
+		ConnectedAt:  s.connectedAt,
+		BoundAt:      s.uc.BoundAt(),
+		LastActivity: s.lastActivity,
+		Received:     make(map[string]int, len(s.ops)),
+		Sent:         s.conn.sent(),
+	}
+	for op, n := range s.ops {
+		info.Received[op] = n
+	}
+	switch {
+	case time.Now().Before(s.stalledUntil):
+		info.State = StateStalled
+	case s.outbound:
+		info.State = StateOutbound
+	case s.uc.Provisioning():
+		info.State = StateProvisioning
+	case info.Account != "":
+		info.State = StateBound
+	}
+	return info
+}
+
+// event returns the data of the session events.
+func (s *session) event() event.Session {
+	return event.Session{
+		ID:         s.id,
+		Profile:    s.uc.Profile.Name,
+		RemoteAddr: s.conn.RemoteAddr().String(),
+		Account:    s.uc.Account(),
+	}
+}
+
+type sessionList struct {
+	sync.Mutex
+	m map[string]*session
+}
+
+func (l *sessionList) add(s *session) {
+	l.Lock()
+	l.m[s.id] = s
+	l.Unlock()
+	event.Publish(event.SessionOpened, s.event())
+}
+
+func (l *sessionList) remove(s *session) {
+	l.Lock()
+	delete(l.m, s.id)
+	l.Unlock()
+	event.Publish(event.SessionClosed, s.event())
+}
+
+func (l *sessionList) get(id string) *session {
+	l.Lock()
+	defer l.Unlock()
+	return l.m[id]
+}
+
+func (l *sessionList) list() []*session {
+	l.Lock()
+	defer l.Unlock()
+	list := make([]*session, 0, len(l.m))
+	for _, s := range l.m {
+		list = append(list, s)
+	}
+	return list
+}
+
+// Sessions returns the connected client sessions in the order they connected.
+func Sessions() []SessionInfo {
+	list := sessions.list()
+	sort.Slice(list, func(i, j int) bool { return list[i].connectedAt.Before(list[j].connectedAt) })
+	infos := make([]SessionInfo, len(list))
+	for i, s := range list {
+		infos[i] = s.info()
+	}
+	return infos
+}
+
+// Session returns the client session with the given id.
+func Session(id string) (SessionInfo, bool) {
+	s := sessions.get(id)
+	if s == nil {
+		return SessionInfo{}, false
+	}
+	return s.info(), true
+}
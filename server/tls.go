@@ -0,0 +1,56 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+// listenTLS opens the UCP over TLS listener.
+func listenTLS(config util.TLS) (net.Listener, error) {
+	cert, err := tls.LoadX509KeyPair(config.Cert, config.Key)
+	if err != nil {
+		return nil, errors.Wrap(err, "Loading TLS certificate failed")
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+	if config.CA != "" {
+		pem, err := ioutil.ReadFile(config.CA)
+		if err != nil {
+			return nil, errors.Wrap(err, "Loading TLS CA failed")
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("No certificate found in TLS CA")
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	if config.RequireClientCert {
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tls.Listen("tcp", fmt.Sprintf(":%d", config.Port), tlsConfig)
+}
+
+// handshakeTimeout is how long a client may take to complete the TLS handshake,
+// so that a client that never sends its hello does not hold the connection open.
+const handshakeTimeout = 10 * time.Second
+
+// certAccount completes the TLS handshake and returns the common name of the client certificate.
+func certAccount(conn *tls.Conn) (string, error) {
+	if err := conn.Handshake(); err != nil {
+		return "", errors.Wrap(err, "TLS handshake failed")
+	}
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return "", nil
+	}
+	return certs[0].Subject.CommonName, nil
+}
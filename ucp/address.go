@@ -0,0 +1,77 @@
+package ucp
+
+import (
+	"strings"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// Maximum lengths of originator addresses
+const (
+	maxNumericAddress      = 16
+	maxAlphanumericAddress = 11
+)
+
+// acceptRecipient returns the error code if a message from the originator to the recipient must be rejected,
+// or an empty string.
+func acceptRecipient(conf util.Profile, conn *Conn, originator, recipient string) ErrorCode {
+	if !validOriginator(originator) || !validRecipient(conf.AddressRules, recipient) {
+		return AdCInvalid
+	}
+	account, _ := conf.Account(conn.Account())
+	if !permitted(conf.AddressRules, account, recipient) {
+		return CallBarringActive
+	}
+	if barred(conf, conn.Account(), originator, recipient) || subscriberBarred(recipient) {
+		return CallBarringActive
+	}
+	return ""
+}
+
+// validOriginator returns true if the originator is empty, a numeric address or an alphanumeric sender id.
+func validOriginator(originator string) bool {
+	if isNumeric([]byte(originator)) {
+		return len(originator) <= maxNumericAddress
+	}
+	return len(originator) <= maxAlphanumericAddress
+}
+
+// validRecipient returns true if the recipient has a valid format, length and country code.
+func validRecipient(rules util.AddressRules, recipient string) bool {
+	minLen, maxLen := rules.MinLen, rules.MaxLen
+	if minLen <= 0 {
+		minLen = 1
+	}
+	if maxLen <= 0 {
+		maxLen = maxNumericAddress
+	}
+	if len(recipient) < minLen || len(recipient) > maxLen {
+		return false
+	}
+	if !rules.AllowAlphanumeric && !isNumeric([]byte(recipient)) {
+		return false
+	}
+	return len(rules.CountryCodes) == 0 || hasPrefix(recipient, rules.CountryCodes)
+}
+
+// permitted returns true if the recipient is neither blacklisted nor missing from a whitelist
+// of the profile or the account.
+func permitted(rules util.AddressRules, account util.Account, recipient string) bool {
+	if hasPrefix(recipient, rules.Blacklist) || hasPrefix(recipient, account.Blacklist) {
+		return false
+	}
+	if len(rules.Whitelist) == 0 && len(account.Whitelist) == 0 {
+		return true
+	}
+	return hasPrefix(recipient, rules.Whitelist) || hasPrefix(recipient, account.Whitelist)
+}
+
+// hasPrefix returns true if the address starts with any of the prefixes.
+func hasPrefix(address string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(address, prefix) {
+			return true
+		}
+	}
+	return false
+}
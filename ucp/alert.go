@@ -15,11 +15,37 @@ type Alert struct {
 // NewAlert creates a new Alert PDU.
 func NewAlert(pdu *PDU) *Alert {
 	b := bytes.Split(pdu.Data, []byte("/"))
-	return &Alert{
-		pdu: pdu,
-		AdC: b[0],
-		PID: b[1],
+	a := &Alert{pdu: pdu}
+	if len(b) == 2 {
+		a.AdC, a.PID = b[0], b[1]
 	}
+	return a
+}
+
+// validate returns the error code of an invalid Alert, or an empty string.
+func (a *Alert) validate() ErrorCode {
+	const (
+		PCOverTCPIP       = "0539"
+		PCOverAbbreviated = "0639"
+	)
+	if len(a.AdC) == 0 || len(a.AdC) > 16 || !isNumeric(a.AdC) {
+		return AdCInvalid
+	}
+	switch string(a.PID) {
+	case PCOverTCPIP, PCOverAbbreviated:
+		return ""
+	}
+	return SyntaxError
+}
+
+// isNumeric returns true if b only contains decimal digits.
+func isNumeric(b []byte) bool {
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
 }
 
 // Result returns an Alert Operation Result.
@@ -0,0 +1,127 @@
+package ucp
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+// AccountBalance is the credit of a prepaid account.
+type AccountBalance struct {
+	Profile string  `json:"profile"`
+	Account string  `json:"account"`
+	Balance float64 `json:"balance"`
+	// LowBalance is the threshold below which the balance is reported as low
+	LowBalance float64 `json:"low_balance"`
+	Low        bool    `json:"low"`
+}
+
+// balances are the prepaid account balances, keyed by profile and user.
+var balances = struct {
+	sync.Mutex
+	m map[string]*AccountBalance
+}{
+	m: make(map[string]*AccountBalance),
+}
+
+// InitBalances opens the balances of the prepaid accounts of the profile with their initial credit.
+func InitBalances(conf util.Profile) {
+	balances.Lock()
+	defer balances.Unlock()
+	for _, a := range conf.Accounts {
+		if !a.Prepaid {
+			continue
+		}
+		b := &AccountBalance{Profile: conf.Name, Account: a.User, Balance: a.Balance, LowBalance: a.LowBalance}
+		b.Low = b.Balance < b.LowBalance
+		balances.m[conf.Name+"/"+a.User] = b
+	}
+}
+
+// Balances returns the balances of all prepaid accounts.
+func Balances() []AccountBalance {
+	balances.Lock()
+	defer balances.Unlock()
+	list := make([]AccountBalance, 0, len(balances.m))
+	for _, b := range balances.m {
+		list = append(list, *b)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Profile != list[j].Profile {
+			return list[i].Profile < list[j].Profile
+		}
+		return list[i].Account < list[j].Account
+	})
+	return list
+}
+
+// Balance returns the balance of a prepaid account.
+func Balance(profile, account string) (AccountBalance, bool) {
+	balances.Lock()
+	defer balances.Unlock()
+	b, ok := balances.m[profile+"/"+account]
+	if !ok {
+		return AccountBalance{}, false
+	}
+	return *b, true
+}
+
+// TopUp adds credit to a prepaid account and returns its new balance.
+func TopUp(profile, account string, amount float64) (AccountBalance, error) {
+	if amount <= 0 {
+		return AccountBalance{}, errors.New("Top-up amount must be positive")
+	}
+	balances.Lock()
+	defer balances.Unlock()
+	b, ok := balances.m[profile+"/"+account]
+	if !ok {
+		return AccountBalance{}, errors.Errorf("No prepaid account %s/%s", profile, account)
+	}
+	b.Balance += amount
+	b.Low = b.Balance < b.LowBalance
+	return *b, nil
+}
+
+// SetLowBalance changes the low balance threshold of a prepaid account.
+func SetLowBalance(profile, account string, threshold float64) (AccountBalance, error) {
+	balances.Lock()
+	defer balances.Unlock()
+	b, ok := balances.m[profile+"/"+account]
+	if !ok {
+		return AccountBalance{}, errors.Errorf("No prepaid account %s/%s", profile, account)
+	}
+	b.LowBalance = threshold
+	b.Low = b.Balance < b.LowBalance
+	return *b, nil
+}
+
+// debit charges a prepaid account and returns false if its balance does not cover the cost.
+// Accounts that are not prepaid are never refused.
+func debit(conf util.Profile, account string, cost float64) bool {
+	balances.Lock()
+	defer balances.Unlock()
+	b, ok := balances.m[conf.Name+"/"+account]
+	if !ok {
+		return true
+	}
+	if b.Balance < cost {
+		return false
+	}
+	b.Balance -= cost
+	if !b.Low && b.Balance < b.LowBalance {
+		log.Printf("Balance of %s/%s is low: %.4f", b.Profile, b.Account, b.Balance)
+	}
+	b.Low = b.Balance < b.LowBalance
+	return true
+}
+
+// fundsError returns the configured error code for submits refused for insufficient funds.
+func fundsError(conf util.Profile) ErrorCode {
+	if conf.FundsError == "" {
+		return OperationNotAllowed
+	}
+	return ErrorCode(conf.FundsError)
+}
@@ -0,0 +1,34 @@
+package ucp
+
+import (
+	"testing"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestDebit(t *testing.T) {
+	conf := util.Profile{Name: "debit", Accounts: []util.Account{
+		{User: "empty", Prepaid: true},
+		{User: "funded", Prepaid: true, Balance: 1},
+		{User: "postpaid"},
+	}}
+	InitBalances(conf)
+	tests := []struct {
+		name    string
+		account string
+		cost    float64
+		ok      bool
+	}{
+		{"free message at zero balance", "empty", 0, true},
+		{"paid message at zero balance", "empty", 0.5, false},
+		{"cost within balance", "funded", 0.5, true},
+		{"cost equal to the rest", "funded", 0.5, true},
+		{"cost over balance", "funded", 0.5, false},
+		{"not prepaid", "postpaid", 10, true},
+	}
+	for _, tt := range tests {
+		if ok := debit(conf, tt.account, tt.cost); ok != tt.ok {
+			t.Errorf("%s: debit() = %v, want %v", tt.name, ok, tt.ok)
+		}
+	}
+}
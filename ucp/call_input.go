@@ -0,0 +1,225 @@
+package ucp
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// CallInput is a Call Input Operation(01).
+type CallInput struct {
+	pdu  *PDU
+	AdC  []byte
+	OAdC []byte
+	AC   []byte
+	MT   []byte
+	Msg  []byte
+}
+
+// NewCallInput creates a new Call Input Operation PDU.
+func NewCallInput(pdu *PDU) *CallInput {
+	b := bytes.Split(pdu.Data, []byte("/"))
+	for len(b) < 5 {
+		b = append(b, []byte{})
+	}
+	return &CallInput{
+		pdu:  pdu,
+		AdC:  b[0],
+		OAdC: b[1],
+		AC:   b[2],
+		MT:   b[3],
+		Msg:  b[4],
+	}
+}
+
+// GetMessage returns the decoded message
+func (ci *CallInput) GetMessage() string {
+	return callInputMessage(ci.MT, ci.Msg)
+}
+
+// handle accepts the message and returns the result.
+func (ci *CallInput) handle(conf util.Profile) []byte {
+	pdu := ci.pdu
+	if throttled(conf, pdu.conn.Account()) {
+		return pdu.Nack(throttleError(conf))
+	}
+	if code := checkCallInput(ci.MT, ci.Msg); code != "" {
+		return pdu.Nack(code)
+	}
+	recipient := string(ci.AdC)
+	if code := acceptRecipient(conf, pdu.conn, string(ci.OAdC), recipient); code != "" {
+		return pdu.Nack(code)
+	}
+	scts := issueSCTS(recipient)
+	id := bill(conf, pdu, billable{
+		operation:  CALL_INPUT_OP,
+		account:    pdu.conn.Account(),
+		originator: string(ci.OAdC),
+		recipient:  recipient,
+		scts:       scts,
+		segments:   1,
+		message:    ci.GetMessage(),
+		encoding:   GSM7,
+	})
+	if id == "" {
+		return pdu.Nack(fundsError(conf))
+	}
+	record(string(ci.OAdC), recipient, ci.GetMessage())
+	if conf.NotifyCallInput {
+		go notify(conf, pdu, pdu.conn, id, recipient, scts)
+	}
+	return pdu.result([]byte("A"), []byte(""), []byte(recipient+":"+scts))
+}
+
+// MultipleCallInput is a Multiple Address Call Input Operation(02).
+type MultipleCallInput struct {
+	pdu  *PDU
+	NPL  []byte
+	RAds [][]byte
+	OAdC []byte
+	AC   []byte
+	MT   []byte
+	Msg  []byte
+}
+
+// NewMultipleCallInput creates a new Multiple Address Call Input Operation PDU.
+func NewMultipleCallInput(pdu *PDU) *MultipleCallInput {
+	b := bytes.Split(pdu.Data, []byte("/"))
+	npl, _ := strconv.Atoi(string(b[0]))
+	if npl < 0 || npl > len(b)-1 {
+		npl = len(b) - 1
+	}
+	rest := b[1+npl:]
+	for len(rest) < 4 {
+		rest = append(rest, []byte{})
+	}
+	return &MultipleCallInput{
+		pdu:  pdu,
+		NPL:  b[0],
+		RAds: b[1 : 1+npl],
+		OAdC: rest[0],
+		AC:   rest[1],
+		MT:   rest[2],
+		Msg:  rest[3],
+	}
+}
+
+// GetRecipients returns the recipient addresses without their legitimisation codes
+func (mci *MultipleCallInput) GetRecipients() []string {
+	recipients := make([]string, len(mci.RAds))
+	for i, rad := range mci.RAds {
+		recipients[i] = strings.SplitN(string(rad), ",", 2)[0]
+	}
+	return recipients
+}
+
+// GetMessage returns the decoded message
+func (mci *MultipleCallInput) GetMessage() string {
+	return callInputMessage(mci.MT, mci.Msg)
+}
+
+// handle accepts the message for each recipient and returns the result.
+// The system message lists every recipient as AdC:SCTS if accepted or AdC:EC if rejected.
+// Each recipient takes a token of the rate limit. The result is an ACK if any recipient is accepted,
+// as the accepted recipients are billed and notified, and a NACK carrying the first error code otherwise.
+// Fault rules are matched per recipient: a NACK rule rejects the recipient, a drop rule drops the operation
+// before anyone is billed, and the first other rule applies to the result, which is returned with it.
+func (mci *MultipleCallInput) handle(conf util.Profile) ([]byte, *Fault) {
+	pdu := mci.pdu
+	npl, err := strconv.Atoi(string(mci.NPL))
+	if err != nil || npl == 0 || npl != len(mci.RAds) {
+		return pdu.Nack(SyntaxError), nil
+	}
+	if code := checkCallInput(mci.MT, mci.Msg); code != "" {
+		return pdu.Nack(code), nil
+	}
+	recipients := mci.GetRecipients()
+	nacks := make([]*Fault, len(recipients))
+	var fault *Fault
+	for i, recipient := range recipients {
+		f := matchFault(MULTIPLE_CALL_INPUT_OP, pdu.conn, recipient)
+		switch {
+		case f == nil:
+		case f.Action == FaultNack:
+			nacks[i] = f
+		case f.Action == FaultDrop:
+			return nil, f
+		case fault == nil:
+			fault = f
+		}
+	}
+	results := make([]string, 0, npl)
+	var failure ErrorCode
+	accepted := 0
+	for i, recipient := range recipients {
+		code := acceptRecipient(conf, pdu.conn, string(mci.OAdC), recipient)
+		if code == "" && nacks[i] != nil {
+			code = nacks[i].ErrorCode
+		}
+		if code == "" && throttled(conf, pdu.conn.Account()) {
+			code = throttleError(conf)
+		}
+		id, scts := "", ""
+		if code == "" {
+			scts = issueSCTS(recipient)
+			id = bill(conf, pdu, billable{
+				operation:  MULTIPLE_CALL_INPUT_OP,
+				account:    pdu.conn.Account(),
+				originator: string(mci.OAdC),
+				recipient:  recipient,
+				scts:       scts,
+				segments:   1,
+				message:    mci.GetMessage(),
+				encoding:   GSM7,
+			})
+			if id == "" {
+				code = fundsError(conf)
+			}
+		}
+		if code != "" {
+			if failure == "" {
+				failure = code
+			}
+			results = append(results, recipient+":"+string(code))
+			continue
+		}
+		accepted++
+		record(string(mci.OAdC), recipient, mci.GetMessage())
+		if conf.NotifyCallInput {
+			go notify(conf, pdu, pdu.conn, id, recipient, scts)
+		}
+		results = append(results, recipient+":"+scts)
+	}
+	if accepted == 0 {
+		return pdu.nack(failure, strings.Join(results, ",")), fault
+	}
+	return pdu.result([]byte("A"), []byte(""), []byte(strings.Join(results, ","))), fault
+}
+
+// callInputMessage decodes a numeric or alphanumeric message.
+func callInputMessage(mt, msg []byte) string {
+	const AMsg = "3"
+	if string(mt) == AMsg {
+		return decodeIRA(msg)
+	}
+	return string(msg)
+}
+
+// checkCallInput returns the error code of an invalid message type or message, or an empty string.
+func checkCallInput(mt, msg []byte) ErrorCode {
+	const (
+		NMsg = "2"
+		AMsg = "3"
+	)
+	switch string(mt) {
+	case NMsg, AMsg:
+	default:
+		return MessageTypeNotSupport
+	}
+	if (&Submit{MT: mt, Msg: msg}).IsTooLong() {
+		return MessageTooLong
+	}
+	return ""
+}
@@ -0,0 +1,250 @@
+package ucp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+// CDRType is the kind of event a call detail record is written for.
+type CDRType string
+
+const (
+	// CDRSubmit is an accepted and billed message submitted by a client
+	CDRSubmit CDRType = "submit"
+	// CDRNotification is a delivery notification sent to a client
+	CDRNotification CDRType = "dn"
+	// CDRMO is a mobile originated message delivered to a client
+	CDRMO CDRType = "mo"
+)
+
+// cdrTimeLayout is the time format of CDR file names
+const cdrTimeLayout = "20060102T1504"
+
+// CDR is a call detail record.
+type CDR struct {
+	Time       time.Time `json:"time"`
+	Type       CDRType   `json:"type"`
+	Profile    string    `json:"profile"`
+	Account    string    `json:"account"`
+	Operation  string    `json:"operation"`
+	OAdC       string    `json:"oadc"`
+	AdC        string    `json:"adc"`
+	Identifier string    `json:"identifier"`
+	Cost       float64   `json:"cost"`
+	Segments   int       `json:"segments"`
+	SCTS       string    `json:"scts"`
+	// Status and Reason are the outcome of a delivery notification
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+	// Latency is the time in milliseconds from the submit to the delivery notification
+	Latency int64 `json:"latency"`
+}
+
+var cdrHeader = []string{"time", "type", "profile", "account", "operation", "oadc", "adc", "identifier",
+	"cost", "segments", "scts", "status", "reason", "latency"}
+
+// record returns the CSV fields of the CDR.
+func (c CDR) record() []string {
+	return []string{
+		c.Time.Format(time.RFC3339Nano), string(c.Type), c.Profile, c.Account, c.Operation, c.OAdC, c.AdC, c.Identifier,
+		strconv.FormatFloat(c.Cost, 'f', -1, 64), strconv.Itoa(c.Segments), c.SCTS, c.Status, c.Reason,
+		strconv.FormatInt(c.Latency, 10),
+	}
+}
+
+// parseCDR reads a CDR from its CSV fields.
+func parseCDR(rec []string) (CDR, error) {
+	if len(rec) != len(cdrHeader) {
+		return CDR{}, errors.Errorf("Expected %d CDR fields, got %d", len(cdrHeader), len(rec))
+	}
+	t, err := time.Parse(time.RFC3339Nano, rec[0])
+	if err != nil {
+		return CDR{}, err
+	}
+	c := CDR{Time: t, Type: CDRType(rec[1]), Profile: rec[2], Account: rec[3], Operation: rec[4], OAdC: rec[5],
+		AdC: rec[6], Identifier: rec[7], SCTS: rec[10], Status: rec[11], Reason: rec[12]}
+	c.Cost, _ = strconv.ParseFloat(rec[8], 64)
+	c.Segments, _ = strconv.Atoi(rec[9])
+	c.Latency, _ = strconv.ParseInt(rec[13], 10, 64)
+	return c, nil
+}
+
+var cdrs = struct {
+	sync.Mutex
+	conf  util.CDROutput
+	file  *os.File
+	start time.Time
+}{}
+
+// OpenCDRs starts writing CDRs to rotated files in the configured directory.
+func OpenCDRs(conf util.CDROutput) error {
+	if conf.Format == "" {
+		conf.Format = "csv"
+	}
+	if conf.Format != "csv" && conf.Format != "json" {
+		return errors.Errorf("Invalid CDR format %q", conf.Format)
+	}
+	if conf.Rotate <= 0 {
+		conf.Rotate = 60
+	}
+	if conf.Dir != "" {
+		if err := os.MkdirAll(conf.Dir, 0755); err != nil {
+			return errors.Wrap(err, "Creating CDR directory failed")
+		}
+	}
+	cdrs.Lock()
+	defer cdrs.Unlock()
+	cdrs.conf = conf
+	return nil
+}
+
+// WriteCDR appends a CDR to the current file, opening a new file when the rotation period is over.
+func WriteCDR(c CDR) {
+	if c.Time.IsZero() {
+		c.Time = time.Now()
+	}
+	cdrs.Lock()
+	defer cdrs.Unlock()
+	if cdrs.conf.Dir == "" {
+		return
+	}
+	period := time.Duration(cdrs.conf.Rotate) * time.Minute
+	start := c.Time.Truncate(period)
+	if cdrs.file == nil || !start.Equal(cdrs.start) {
+		if cdrs.file != nil {
+			cdrs.file.Close()
+		}
+		name := filepath.Join(cdrs.conf.Dir, "cdr-"+start.UTC().Format(cdrTimeLayout)+"."+cdrs.conf.Format)
+		f, err := os.OpenFile(name, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			log.Println("Opening CDR file failed: ", err)
+			cdrs.file = nil
+			return
+		}
+		cdrs.file, cdrs.start = f, start
+		if info, err := f.Stat(); err == nil && info.Size() == 0 && cdrs.conf.Format == "csv" {
+			writeCDRs(f, "csv", nil)
+		}
+	}
+	if err := writeCDRs(cdrs.file, cdrs.conf.Format, []CDR{c}); err != nil {
+		log.Println("Writing CDR failed: ", err)
+	}
+}
+
+// writeCDRs writes the CDRs in csv or json format. A nil slice writes the CSV header.
+func writeCDRs(w io.Writer, format string, list []CDR) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		for _, c := range list {
+			if err := enc.Encode(c); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	cw := csv.NewWriter(w)
+	if list == nil {
+		cw.Write(cdrHeader)
+	}
+	for _, c := range list {
+		cw.Write(c.record())
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// ExportCDRs writes the CDRs written from from until to in the given format.
+func ExportCDRs(w io.Writer, format string, from, to time.Time) error {
+	cdrs.Lock()
+	conf := cdrs.conf
+	cdrs.Unlock()
+	if conf.Dir == "" {
+		return errors.New("CDRs are disabled")
+	}
+	files, err := ioutil.ReadDir(conf.Dir)
+	if err != nil {
+		return errors.Wrap(err, "Reading CDR directory failed")
+	}
+	names := make([]string, 0, len(files))
+	for _, f := range files {
+		names = append(names, f.Name())
+	}
+	sort.Strings(names)
+	if format == "csv" {
+		writeCDRs(w, format, nil)
+	}
+	for _, name := range names {
+		ext := filepath.Ext(name)
+		start, err := time.Parse(cdrTimeLayout, strings.TrimSuffix(strings.TrimPrefix(name, "cdr-"), ext))
+		if err != nil || (!to.IsZero() && start.After(to)) {
+			continue
+		}
+		// WriteCDR appends to the current file under the lock, so holding it never reads a half-written CDR
+		cdrs.Lock()
+		list, err := readCDRs(filepath.Join(conf.Dir, name), strings.TrimPrefix(ext, "."))
+		cdrs.Unlock()
+		if err != nil {
+			return err
+		}
+		selected := make([]CDR, 0, len(list))
+		for _, c := range list {
+			if (from.IsZero() || !c.Time.Before(from)) && (to.IsZero() || c.Time.Before(to)) {
+				selected = append(selected, c)
+			}
+		}
+		if err := writeCDRs(w, format, selected); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readCDRs reads the CDRs of a file.
+func readCDRs(path, format string) ([]CDR, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Opening CDR file failed")
+	}
+	defer f.Close()
+	list := make([]CDR, 0)
+	if format == "json" {
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			var c CDR
+			if err := json.Unmarshal(scanner.Bytes(), &c); err != nil {
+				return nil, errors.Wrap(err, "Reading CDR file failed")
+			}
+			list = append(list, c)
+		}
+		return list, scanner.Err()
+	}
+	records, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		return nil, errors.Wrap(err, "Reading CDR file failed")
+	}
+	for i, rec := range records {
+		if i == 0 && len(rec) > 0 && rec[0] == cdrHeader[0] {
+			continue
+		}
+		c, err := parseCDR(rec)
+		if err != nil {
+			return nil, errors.Wrap(err, "Reading CDR file failed")
+		}
+		list = append(list, c)
+	}
+	return list, nil
+}
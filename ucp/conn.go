@@ -0,0 +1,169 @@
+package ucp
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/event"
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// Conn is a client connection together with the state of its UCP session.
+type Conn struct {
+	net.Conn
+	// ID identifies the session
+	ID string
+	// Profile is the behaviour of the listener that accepted the connection
+	Profile util.Profile
+	reader  *bufio.Reader
+	wmu     sync.Mutex
+	mu      sync.Mutex
+	account string
+	boundAt time.Time
+	// provisioning is true for sessions opened as provisioning sessions
+	provisioning bool
+	// trn is the transaction reference number of the last operation sent to the client
+	trn int
+	// pending are the delivery notifications awaiting a result, by TRN
+	pending map[string]*pendingDN
+}
+
+// pendingDN is a delivery notification sent to the client that awaits its result.
+type pendingDN struct {
+	// id of the message notified about
+	id string
+	// recorded is closed once the notification is written and its status stored
+	recorded chan struct{}
+}
+
+// NewConn wraps a client connection.
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		Conn:   c,
+		reader: bufio.NewReader(c),
+	}
+}
+
+// Write writes a complete frame to the client.
+// Frames written from concurrent goroutines are never interleaved.
+func (c *Conn) Write(b []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	return c.write(b)
+}
+
+// WriteTimeout writes a complete frame like Write, failing if the client does not take it within d.
+func (c *Conn) WriteTimeout(b []byte, d time.Duration) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.Conn.SetWriteDeadline(time.Now().Add(d))
+	defer c.Conn.SetWriteDeadline(time.Time{})
+	return c.write(b)
+}
+
+func (c *Conn) write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	observeBytes(0, n)
+	if err == nil {
+		event.Publish(event.FrameSent, frameEvent(logFrame(c, DirectionOut, b)))
+	}
+	return n, err
+}
+
+// frameEvent returns the event data of a logged frame.
+func frameEvent(e TrafficEntry) event.Frame {
+	return event.Frame{Session: e.Session, TRN: e.TRN, Type: e.Type, Operation: e.Operation, Frame: e.Frame}
+}
+
+// Account returns the user the session has authenticated as, or an empty string.
+func (c *Conn) Account() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.account
+}
+
+// BoundAt returns when the session authenticated, or the zero time.
+func (c *Conn) BoundAt() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.boundAt
+}
+
+// Bind authenticates the session as the given user.
+func (c *Conn) Bind(account string) {
+	c.mu.Lock()
+	c.account = account
+	c.boundAt = time.Now()
+	c.provisioning = false
+	c.mu.Unlock()
+	event.Publish(event.SessionBound, event.Session{
+		ID:         c.ID,
+		Profile:    c.Profile.Name,
+		RemoteAddr: c.RemoteAddr().String(),
+		Account:    account,
+	})
+}
+
+// Provisioning returns true if the session is a provisioning session.
+func (c *Conn) Provisioning() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.provisioning
+}
+
+// track returns the transaction reference number of the next operation sent to the client,
+// remembering the message it notifies about until the client returns a result.
+// TRNs still awaiting a result are skipped unless all of them are, then the oldest one is reused.
+// The returned function must be called once the notification is written and its status stored,
+// or with false if writing it failed.
+func (c *Conn) track(id string) (string, func(sent bool)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pending == nil {
+		c.pending = make(map[string]*pendingDN)
+	}
+	next := (c.trn + 1) % 100
+	for i := 0; i < 100; i++ {
+		if _, ok := c.pending[fmt.Sprintf("%02d", (next+i)%100)]; !ok {
+			next = (next + i) % 100
+			break
+		}
+	}
+	c.trn = next
+	trn := fmt.Sprintf("%02d", c.trn)
+	p := &pendingDN{id: id, recorded: make(chan struct{})}
+	c.pending[trn] = p
+	return trn, func(sent bool) {
+		if !sent {
+			c.mu.Lock()
+			if c.pending[trn] == p {
+				delete(c.pending, trn)
+			}
+			c.mu.Unlock()
+		}
+		close(p.recorded)
+	}
+}
+
+// resolve returns and forgets the message notified about by the operation with the given TRN.
+// It waits until the status of the notification is stored, so that the result is recorded after it.
+func (c *Conn) resolve(trn string) (string, bool) {
+	c.mu.Lock()
+	p, ok := c.pending[trn]
+	delete(c.pending, trn)
+	c.mu.Unlock()
+	if !ok {
+		return "", false
+	}
+	<-p.recorded
+	return p.id, true
+}
+
+func (c *Conn) setProvisioning() {
+	c.mu.Lock()
+	c.provisioning = true
+	c.mu.Unlock()
+}
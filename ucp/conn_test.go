@@ -0,0 +1,91 @@
+package ucp
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestConnTrack(t *testing.T) {
+	c := &Conn{}
+	trn, recorded := c.track("a")
+	if trn != "01" {
+		t.Fatalf("track() = %s, want 01", trn)
+	}
+	recorded(true)
+	// TRNs 02 to 99 and 00 are free, 01 is still pending
+	for i := 2; i <= 100; i++ {
+		got, recorded := c.track(fmt.Sprint(i))
+		recorded(true)
+		if want := fmt.Sprintf("%02d", i%100); got != want {
+			t.Fatalf("track() = %s, want %s", got, want)
+		}
+	}
+	// all TRNs are pending, the oldest one is reused
+	got, recorded := c.track("b")
+	recorded(true)
+	if got != "01" {
+		t.Errorf("track() with all TRNs pending = %s, want 01", got)
+	}
+	if id, ok := c.resolve("01"); !ok || id != "b" {
+		t.Errorf("resolve(01) = %s, %v, want b, true", id, ok)
+	}
+	if _, ok := c.resolve("01"); ok {
+		t.Errorf("resolve(01) twice succeeded")
+	}
+	if got, _ := c.track("c"); got != "01" {
+		t.Errorf("track() after resolving 01 = %s, want 01", got)
+	}
+	c.resolve("05")
+	if got, _ := c.track("d"); got != "05" {
+		t.Errorf("track() after resolving 05 = %s, want 05", got)
+	}
+}
+
+func TestConnResolveWaitsForStatus(t *testing.T) {
+	c := &Conn{}
+	trn, recorded := c.track("a")
+	done := make(chan string)
+	go func() {
+		id, _ := c.resolve(trn)
+		done <- id
+	}()
+	select {
+	case <-done:
+		t.Fatal("resolve() returned before the status was recorded")
+	case <-time.After(20 * time.Millisecond):
+	}
+	recorded(true)
+	if id := <-done; id != "a" {
+		t.Errorf("resolve() = %s, want a", id)
+	}
+}
+
+func TestConnTrackUnsent(t *testing.T) {
+	c := &Conn{}
+	trn, recorded := c.track("a")
+	recorded(false)
+	if _, ok := c.resolve(trn); ok {
+		t.Errorf("resolve() of an unsent notification succeeded")
+	}
+}
+
+func TestConnWriteTimeout(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	c := NewConn(server)
+	start := time.Now()
+	if _, err := c.WriteTimeout([]byte("frame"), 20*time.Millisecond); err == nil {
+		t.Fatal("WriteTimeout() to a stalled client succeeded")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("WriteTimeout() took %v", d)
+	}
+	go io.Copy(ioutil.Discard, client)
+	if _, err := c.Write([]byte("frame")); err != nil {
+		t.Errorf("Write() after a timeout = %v, want the deadline cleared", err)
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/hex"
 	"fmt"
 	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
 )
 
 // DeliverNotification is a Deliver Notification Operation(53).
@@ -43,26 +45,47 @@ type DeliverNotification struct {
 	Xser  []byte
 	RES4  []byte
 	RES5  []byte
+	// deliveredAt is when the delivery was attempted
+	deliveredAt time.Time
+	// templates of the notification text
+	templates util.DNTemplates
+	// trn is the transaction reference number, 99 if not set
+	trn string
 }
 
-// NewDeliverNotification creates a new Deliver Notification PDU.
+// NewDeliverNotification creates a new Deliver Notification PDU for a delivery attempted now.
 func NewDeliverNotification(pdu *PDU, AdC, OAdC, SCTS string) *DeliverNotification {
-	tscts, _ := time.Parse("020106150405", SCTS)
-	after2s := tscts.Add(2 * time.Second)
-	msg := []byte("Message for " + OAdC + " with identification " + OAdC + ":" + SCTS + " has been delivered at " + after2s.String())
-	msgIra := make([]byte, hex.EncodedLen(len(msg)))
-	hex.Encode(msgIra, msg)
-	return &DeliverNotification{
-		pdu:   pdu,
-		AdC:   []byte(AdC),
-		OAdC:  []byte(OAdC),
-		SCTS:  []byte(SCTS),
-		Dst:   []byte("0"),
-		Rsn:   []byte("000"),
-		DSCTS: []byte(after2s.Format("020106150405")),
-		MT:    []byte("3"),
-		Msg:   msgIra,
+	now := time.Now()
+	d := &DeliverNotification{
+		pdu:         pdu,
+		AdC:         []byte(AdC),
+		OAdC:        []byte(OAdC),
+		SCTS:        []byte(SCTS),
+		DSCTS:       []byte(now.Format("020106150405")),
+		MT:          []byte("3"),
+		deliveredAt: now,
+	}
+	if pdu != nil && pdu.conn != nil {
+		d.templates = pdu.conn.Profile.DNTemplates
 	}
+	d.setStatus(Delivered, reasonNone)
+	return d
+}
+
+// setStatus sets the delivery status and reason code and the notification text describing them.
+func (d *DeliverNotification) setStatus(dst, rsn string) {
+	msg := []byte(renderDN(d.templates, dnText{
+		Recipient: string(d.OAdC),
+		SCTS:      string(d.SCTS),
+		DSCTS:     string(d.DSCTS),
+		Status:    dst,
+		Reason:    rsn,
+		Time:      d.deliveredAt,
+	}))
+	d.Dst = []byte(dst)
+	d.Rsn = []byte(rsn)
+	d.Msg = make([]byte, hex.EncodedLen(len(msg)))
+	hex.Encode(d.Msg, msg)
 }
 
 // Result returns a Deliver Notification Result.
@@ -106,8 +129,12 @@ func (d *DeliverNotification) Result() []byte {
 	}
 	bdata := bytes.Join(data, []byte("/"))
 	Len := 17 + len(bdata)
+	trn := d.trn
+	if trn == "" {
+		trn = "99"
+	}
 	partial := [][]byte{
-		[]byte("99"),
+		[]byte(trn),
 		[]byte(fmt.Sprintf("%05d", Len)),
 		[]byte("O"),
 		[]byte("53"),
@@ -0,0 +1,112 @@
+package ucp
+
+import (
+	"bytes"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+// Default delivery notification texts
+const (
+	deliveredText = `Message for {{.Recipient}} with identification {{.Recipient}}:{{.SCTS}} has been delivered at {{.Time.Format "2006-01-02 15:04:05 -0700 MST"}}`
+	bufferedText  = `Message for {{.Recipient}} with identification {{.Recipient}}:{{.SCTS}} has been buffered (reason {{.Reason}})`
+	failedText    = `Message for {{.Recipient}} with identification {{.Recipient}}:{{.SCTS}} could not be delivered (reason {{.Reason}})`
+)
+
+// dnText is the data a delivery notification template is executed with.
+type dnText struct {
+	Recipient string
+	SCTS      string
+	DSCTS     string
+	Status    string
+	Reason    string
+	// Time is when the delivery was attempted
+	Time time.Time
+}
+
+// dnTemplates caches parsed templates by their text.
+var dnTemplates = struct {
+	sync.Mutex
+	m map[string]*template.Template
+}{
+	m: make(map[string]*template.Template),
+}
+
+// parseDNTemplate returns the parsed template of the text.
+func parseDNTemplate(text string) (*template.Template, error) {
+	dnTemplates.Lock()
+	defer dnTemplates.Unlock()
+	if t, ok := dnTemplates.m[text]; ok {
+		return t, nil
+	}
+	t, err := template.New("dn").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	dnTemplates.m[text] = t
+	return t, nil
+}
+
+// dnTemplate returns the template text of the delivery status, falling back to the default text.
+func dnTemplate(templates util.DNTemplates, dst string) (text, fallback string) {
+	switch dst {
+	case Buffered:
+		return templates.Buffered, bufferedText
+	case NotDelivered:
+		return templates.Failed, failedText
+	}
+	return templates.Delivered, deliveredText
+}
+
+// CheckDNTemplates returns an error if any of the delivery notification templates is invalid
+// or renders text that cannot be sent as IRA.
+func CheckDNTemplates(templates util.DNTemplates) error {
+	for _, text := range []string{templates.Delivered, templates.Buffered, templates.Failed} {
+		t, err := parseDNTemplate(text)
+		if err != nil {
+			return errors.Wrap(err, "Invalid delivery notification template")
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, dnText{}); err != nil {
+			return errors.Wrap(err, "Invalid delivery notification template")
+		}
+		if !isIRA(b.String()) {
+			return errors.Errorf("Invalid delivery notification template %q: only IRA characters are allowed", text)
+		}
+	}
+	return nil
+}
+
+// isIRA returns true if the text only has characters of the IRA (7-bit ASCII) alphabet.
+func isIRA(text string) bool {
+	for i := 0; i < len(text); i++ {
+		if text[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// renderDN returns the delivery notification text, or the default text if the profile template fails
+// or renders characters that are not IRA.
+func renderDN(templates util.DNTemplates, data dnText) string {
+	text, fallback := dnTemplate(templates, data.Status)
+	for _, tmpl := range []string{text, fallback} {
+		if tmpl == "" {
+			continue
+		}
+		t, err := parseDNTemplate(tmpl)
+		if err != nil {
+			continue
+		}
+		var b bytes.Buffer
+		if err := t.Execute(&b, data); err == nil && isIRA(b.String()) {
+			return b.String()
+		}
+	}
+	return ""
+}
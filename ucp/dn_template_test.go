@@ -0,0 +1,41 @@
+package ucp
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestCheckDNTemplates(t *testing.T) {
+	tests := []struct {
+		name      string
+		templates util.DNTemplates
+		valid     bool
+	}{
+		{"defaults", util.DNTemplates{}, true},
+		{"IRA", util.DNTemplates{Delivered: "{{.Recipient}} delivered @ {{.DSCTS}}"}, true},
+		{"syntax error", util.DNTemplates{Buffered: "{{.Recipient"}, false},
+		{"unknown field", util.DNTemplates{Failed: "{{.Foo}}"}, false},
+		{"accented", util.DNTemplates{Delivered: "Nachricht für {{.Recipient}} zugestellt"}, false},
+		{"euro sign", util.DNTemplates{Failed: "{{.Recipient}}: €0.00 charged"}, false},
+	}
+	for _, tt := range tests {
+		if err := CheckDNTemplates(tt.templates); (err == nil) != tt.valid {
+			t.Errorf("%s: CheckDNTemplates() = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+}
+
+func TestDeliverNotificationText(t *testing.T) {
+	d := &DeliverNotification{
+		OAdC:      []byte("09170000001"),
+		SCTS:      []byte("191026120000"),
+		templates: util.DNTemplates{Buffered: "{{.Recipient}}:{{.SCTS}} buffered [{{.Reason}}]"},
+	}
+	d.setStatus(Buffered, reasonAbsent)
+	want := hex.EncodeToString([]byte("09170000001:191026120000 buffered [107]"))
+	if string(d.Msg) != want {
+		t.Errorf("Msg = %s, want %s", d.Msg, want)
+	}
+}
@@ -0,0 +1,116 @@
+package ucp
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// ErrorCode is the error code of a Negative Acknowledgement Result.
+type ErrorCode string
+
+const (
+	ChecksumError         ErrorCode = "01"
+	SyntaxError           ErrorCode = "02"
+	OperationNotSupported ErrorCode = "03"
+	OperationNotAllowed   ErrorCode = "04"
+	CallBarringActive     ErrorCode = "05"
+	AdCInvalid            ErrorCode = "06"
+	AuthenticationFailure ErrorCode = "07"
+	LegitimisationFailure ErrorCode = "08"
+	GANotValid            ErrorCode = "09"
+	RepetitionNotAllowed  ErrorCode = "10"
+	PriorityNotAllowed    ErrorCode = "12"
+	UrgentNotAllowed      ErrorCode = "14"
+	ReverseNotAllowed     ErrorCode = "16"
+	DeferredNotAllowed    ErrorCode = "18"
+	NewACNotValid         ErrorCode = "19"
+	StandardTextNotValid  ErrorCode = "21"
+	TimePeriodNotValid    ErrorCode = "22"
+	MessageTypeNotSupport ErrorCode = "23"
+	MessageTooLong        ErrorCode = "24"
+	MessageTypeNotValid   ErrorCode = "26"
+	MessageNotFound       ErrorCode = "27"
+	AddressAlreadyInList  ErrorCode = "33"
+	AddressNotInList      ErrorCode = "34"
+	ListFull              ErrorCode = "35"
+	DeliveryInProgress    ErrorCode = "37"
+	LowNetworkStatus      ErrorCode = "50"
+)
+
+var errorMessages = map[ErrorCode]string{
+	ChecksumError:         "CHECKSUM ERROR",
+	SyntaxError:           "SYNTAX ERROR",
+	OperationNotSupported: "OPERATION NOT SUPPORTED BY SYSTEM",
+	OperationNotAllowed:   "OPERATION NOT ALLOWED",
+	CallBarringActive:     "CALL BARRING ACTIVE",
+	AdCInvalid:            "ADC INVALID",
+	AuthenticationFailure: "AUTHENTICATION FAILURE",
+	LegitimisationFailure: "LEGITIMISATION CODE FOR ALL CALLS, FAILURE",
+	GANotValid:            "GA NOT VALID",
+	RepetitionNotAllowed:  "REPETITION NOT ALLOWED",
+	PriorityNotAllowed:    "PRIORITY CALL NOT ALLOWED",
+	UrgentNotAllowed:      "URGENT MESSAGE NOT ALLOWED",
+	ReverseNotAllowed:     "REVERSE CHARGING NOT ALLOWED",
+	DeferredNotAllowed:    "DEFERRED DELIVERY NOT ALLOWED",
+	NewACNotValid:         "NEW AC NOT VALID",
+	StandardTextNotValid:  "STANDARD TEXT NOT VALID",
+	TimePeriodNotValid:    "TIME PERIOD NOT VALID",
+	MessageTypeNotSupport: "MESSAGE TYPE NOT SUPPORTED BY SYSTEM",
+	MessageTooLong:        "MESSAGE TOO LONG",
+	MessageTypeNotValid:   "MESSAGE TYPE NOT VALID FOR THE PAGER TYPE",
+	MessageNotFound:       "MESSAGE NOT FOUND IN SMSC",
+	AddressAlreadyInList:  "ADDRESS ALREADY IN LIST",
+	AddressNotInList:      "ADDRESS NOT IN LIST",
+	ListFull:              "LIST FULL, CANNOT ADD ADDRESS TO LIST",
+	DeliveryInProgress:    "DELIVERY IN PROGRESS",
+	LowNetworkStatus:      "LOW NETWORK STATUS",
+}
+
+// String returns the system message of the error code.
+func (e ErrorCode) String() string {
+	if msg, ok := errorMessages[e]; ok {
+		return msg
+	}
+	return "ERROR " + string(e)
+}
+
+// result returns a Result for the PDU made of the given fields.
+func (pdu *PDU) result(fields ...[]byte) []byte {
+	b := make([]byte, 0)
+	b = append(b, STX)
+	data := bytes.Join(fields, []byte("/"))
+	Len := 17 + len(data)
+	partial := [][]byte{
+		pdu.TransRefNum,
+		[]byte(fmt.Sprintf("%05d", Len)),
+		[]byte("R"), pdu.Operation,
+		data,
+	}
+	p := append(bytes.Join(partial, []byte("/")), []byte("/")...)
+	chksum := checkSum(p)
+	result := append(p, chksum...)
+	b = append(b, result...)
+	b = append(b, ETX)
+	return b
+}
+
+// ack returns a Positive Acknowledgement Result for the PDU with the given system message.
+func (pdu *PDU) ack(systemMsg string) []byte {
+	return pdu.result([]byte("A"), []byte(systemMsg))
+}
+
+// Nack returns a Negative Acknowledgement Result for the PDU.
+// The error code is translated to the dialect of the connection profile.
+func (pdu *PDU) Nack(code ErrorCode) []byte {
+	return pdu.nack(code, code.String())
+}
+
+// nack returns a Negative Acknowledgement Result for the PDU with the given system message.
+func (pdu *PDU) nack(code ErrorCode, systemMsg string) []byte {
+	if pdu.conn != nil {
+		if c, ok := pdu.conn.Profile.ErrorCodes[string(code)]; ok {
+			code = ErrorCode(c)
+		}
+	}
+	return pdu.result([]byte("N"), []byte(code), []byte(systemMsg))
+}
@@ -0,0 +1,194 @@
+package ucp
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+)
+
+// FaultAction is what a fault rule does to the result of a matching operation.
+type FaultAction string
+
+const (
+	// FaultNack replies with a Negative Acknowledgement
+	FaultNack FaultAction = "nack"
+	// FaultDelay replies after a delay
+	FaultDelay FaultAction = "delay"
+	// FaultDrop swallows the operation without replying
+	FaultDrop FaultAction = "drop"
+	// FaultDuplicate replies twice
+	FaultDuplicate FaultAction = "duplicate"
+	// FaultWrongTRN replies with a transaction reference number that does not match the operation
+	FaultWrongTRN FaultAction = "wrong_trn"
+)
+
+// Fault is a rule for injecting errors into the results sent to clients.
+type Fault struct {
+	ID string `json:"id"`
+	// Enabled defaults to true
+	Enabled bool        `json:"enabled"`
+	Action  FaultAction `json:"action"`
+	// Operation the rule applies to, defaults to Submit Short Message
+	Operation string `json:"operation"`
+	// Percentage of matching operations affected, defaults to 100
+	Percent float64 `json:"percent"`
+	// Error code of the NACK, defaults to 04 operation not allowed
+	ErrorCode ErrorCode `json:"error_code"`
+	// Delay of the result
+	Delay util.Delay `json:"delay"`
+	// Account limits the rule to sessions authenticated as this user
+	Account string `json:"account"`
+	// Session limits the rule to the session with this id
+	Session string `json:"session"`
+	// Prefix limits the rule to recipients starting with this prefix
+	Prefix string `json:"prefix"`
+	// Start and End limit the rule to a time window
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+var faults = struct {
+	sync.Mutex
+	rules []Fault
+}{}
+
+// NewFault returns an enabled rule with the defaults of the optional fields.
+// Decode a rule into it so that omitted fields keep their defaults.
+func NewFault() Fault {
+	return Fault{
+		Enabled:   true,
+		Operation: SUBMIT_SHORT_MESSAGE_OP,
+		Percent:   100,
+		ErrorCode: OperationNotAllowed,
+	}
+}
+
+// validate returns an error if the rule has an unknown action, operation or error code, or an invalid percentage.
+func (f Fault) validate() error {
+	switch f.Operation {
+	case ALERT_OP, SUBMIT_SHORT_MESSAGE_OP, CALL_INPUT_OP, MULTIPLE_CALL_INPUT_OP, SUPPLEMENTARY_SERVICE_OP, MESSAGE_TRANSFER_OP:
+	default:
+		return errors.Errorf("Invalid fault operation %q", f.Operation)
+	}
+	switch f.Action {
+	case FaultNack, FaultDelay, FaultDrop, FaultDuplicate, FaultWrongTRN:
+	default:
+		return errors.Errorf("Invalid fault action %q", f.Action)
+	}
+	if _, ok := errorMessages[f.ErrorCode]; !ok {
+		return errors.Errorf("Invalid error code %q", f.ErrorCode)
+	}
+	if f.Percent < 0 || f.Percent > 100 {
+		return errors.Errorf("Invalid percentage %v", f.Percent)
+	}
+	return nil
+}
+
+// AddFault registers a fault rule and returns it with its id filled in.
+func AddFault(f Fault) (Fault, error) {
+	if err := f.validate(); err != nil {
+		return f, err
+	}
+	if f.ID == "" {
+		f.ID = uuid.NewV4().String()
+	}
+	faults.Lock()
+	defer faults.Unlock()
+	for i := range faults.rules {
+		if faults.rules[i].ID == f.ID {
+			faults.rules[i] = f
+			return f, nil
+		}
+	}
+	faults.rules = append(faults.rules, f)
+	return f, nil
+}
+
+// RemoveFault deletes the fault rule with the given id.
+func RemoveFault(id string) bool {
+	faults.Lock()
+	defer faults.Unlock()
+	for i := range faults.rules {
+		if faults.rules[i].ID == id {
+			faults.rules = append(faults.rules[:i], faults.rules[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Faults returns the registered fault rules.
+func Faults() []Fault {
+	faults.Lock()
+	defer faults.Unlock()
+	return append([]Fault{}, faults.rules...)
+}
+
+// matchFault returns the first enabled rule matching the operation that fires.
+func matchFault(operation string, conn *Conn, recipient string) *Fault {
+	faults.Lock()
+	defer faults.Unlock()
+	now := time.Now()
+	for _, f := range faults.rules {
+		switch {
+		case !f.Enabled, f.Operation != operation:
+		case f.Account != "" && f.Account != conn.Account():
+		case f.Session != "" && f.Session != conn.ID:
+		case !strings.HasPrefix(recipient, f.Prefix):
+		case !f.Start.IsZero() && now.Before(f.Start):
+		case !f.End.IsZero() && now.After(f.End):
+		case rand.Float64()*100 >= f.Percent:
+		default:
+			return &f
+		}
+	}
+	return nil
+}
+
+// respond writes the result to the client, tampered with by the fault rule if any.
+// A delayed result is written by a timer so that the session keeps reading operations meanwhile.
+func (pdu *PDU) respond(f *Fault, res []byte) error {
+	if f != nil {
+		switch f.Action {
+		case FaultDrop:
+			return nil
+		case FaultNack:
+			res = pdu.Nack(f.ErrorCode)
+		case FaultDelay:
+			time.AfterFunc(f.Delay.Duration(), func() {
+				if err := pdu.write(f, res); err != nil {
+					log.Println("Writing delayed result failed: ", err)
+				}
+			})
+			return nil
+		case FaultWrongTRN:
+			res = withTRN(res, (pdu.trn()+1)%100)
+		}
+	}
+	return pdu.write(f, res)
+}
+
+// write stores and writes the result, twice if the fault rule duplicates it.
+func (pdu *PDU) write(f *Fault, res []byte) error {
+	client.Set(ResPacket, string(res), 30*time.Second)
+	pdu.Lock()
+	defer pdu.Unlock()
+	for _, id := range pdu.messageIDs {
+		appendPDU(id, res)
+	}
+	if _, err := pdu.conn.Write(res); err != nil {
+		return err
+	}
+	observeResult(string(pdu.Operation), res, time.Since(pdu.received))
+	if f != nil && f.Action == FaultDuplicate {
+		_, err := pdu.conn.Write(res)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package ucp
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAddFault(t *testing.T) {
+	tests := []struct {
+		name  string
+		json  string
+		valid bool
+		want  Fault
+	}{
+		{"defaults", `{"action":"nack"}`, true, Fault{Enabled: true, Action: FaultNack, Operation: SUBMIT_SHORT_MESSAGE_OP, Percent: 100, ErrorCode: OperationNotAllowed}},
+		{"zero percent", `{"action":"drop","percent":0}`, true, Fault{Enabled: true, Action: FaultDrop, Operation: SUBMIT_SHORT_MESSAGE_OP, Percent: 0, ErrorCode: OperationNotAllowed}},
+		{"disabled", `{"action":"duplicate","enabled":false,"operation":"31","error_code":"05"}`, true, Fault{Action: FaultDuplicate, Operation: ALERT_OP, Percent: 100, ErrorCode: CallBarringActive}},
+		{"missing action", `{}`, false, Fault{}},
+		{"unknown action", `{"action":"explode"}`, false, Fault{}},
+		{"unknown error code", `{"action":"nack","error_code":"99"}`, false, Fault{}},
+		{"percent over 100", `{"action":"nack","percent":150}`, false, Fault{}},
+		{"unknown operation", `{"action":"nack","operation":"5l"}`, false, Fault{}},
+		{"operation without faults", `{"action":"nack","operation":"60"}`, false, Fault{}},
+	}
+	for _, tt := range tests {
+		f := NewFault()
+		if err := json.Unmarshal([]byte(tt.json), &f); err != nil {
+			t.Fatal(err)
+		}
+		got, err := AddFault(f)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: AddFault() error = %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		RemoveFault(got.ID)
+		if got.ID == "" {
+			t.Errorf("%s: AddFault() did not assign an id", tt.name)
+		}
+		got.ID = ""
+		if got != tt.want {
+			t.Errorf("%s: AddFault() = %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
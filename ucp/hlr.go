@@ -0,0 +1,234 @@
+package ucp
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+	"github.com/pkg/errors"
+)
+
+// SubscriberState is the HLR state of a subscriber.
+type SubscriberState string
+
+const (
+	// SubscriberAbsent is a subscriber whose handset is unreachable, messages are buffered
+	SubscriberAbsent SubscriberState = "absent"
+	// SubscriberUnknown is a number that is not allocated, messages fail
+	SubscriberUnknown SubscriberState = "unknown"
+	// SubscriberBarred is a subscriber that may not receive messages, submits are rejected
+	SubscriberBarred SubscriberState = "barred"
+	// SubscriberMemoryFull is a subscriber whose handset has no room for messages, messages are buffered
+	SubscriberMemoryFull SubscriberState = "memory_full"
+	// SubscriberPorted is a subscriber ported to another network, messages are delivered
+	// with the delay of the delivery delay rules of that network
+	SubscriberPorted SubscriberState = "ported"
+)
+
+// Delivery statuses of a Deliver Notification
+const (
+	Delivered    = "0"
+	Buffered     = "1"
+	NotDelivered = "2"
+)
+
+// Reason codes of a Deliver Notification
+const (
+	reasonNone    = "000"
+	reasonUnknown = "101"
+	reasonAbsent  = "107"
+	// memory capacity exceeded is reported as an error in the MS
+	reasonMemoryExceeded = "116"
+)
+
+// Subscriber is an entry of the subscriber database.
+type Subscriber struct {
+	MSISDN string          `json:"msisdn"`
+	State  SubscriberState `json:"state"`
+	// Network is the network a ported subscriber belongs to
+	Network string `json:"network"`
+	// Delay of the delivery notification, the profile delay is used if zero
+	Delay util.Delay `json:"delay"`
+}
+
+var subscribers = struct {
+	sync.Mutex
+	m map[string]Subscriber
+}{
+	m: make(map[string]Subscriber),
+}
+
+// validate returns an error if the subscriber has no MSISDN or an unknown state.
+func (s Subscriber) validate() error {
+	if s.MSISDN == "" {
+		return errors.New("Missing msisdn")
+	}
+	switch s.State {
+	case SubscriberAbsent, SubscriberUnknown, SubscriberBarred, SubscriberMemoryFull, SubscriberPorted:
+		return nil
+	}
+	return errors.Errorf("Invalid subscriber state %q", s.State)
+}
+
+// AddSubscriber adds or replaces a subscriber.
+func AddSubscriber(s Subscriber) error {
+	if err := s.validate(); err != nil {
+		return err
+	}
+	subscribers.Lock()
+	subscribers.m[s.MSISDN] = s
+	subscribers.Unlock()
+	return nil
+}
+
+// RemoveSubscriber deletes the subscriber with the given MSISDN.
+func RemoveSubscriber(msisdn string) bool {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	_, ok := subscribers.m[msisdn]
+	delete(subscribers.m, msisdn)
+	return ok
+}
+
+// Subscribers returns the subscriber database sorted by MSISDN.
+func Subscribers() []Subscriber {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	list := make([]Subscriber, 0, len(subscribers.m))
+	for _, s := range subscribers.m {
+		list = append(list, s)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].MSISDN < list[j].MSISDN })
+	return list
+}
+
+// GetSubscriber returns the subscriber with the given MSISDN.
+func GetSubscriber(msisdn string) (Subscriber, bool) {
+	subscribers.Lock()
+	defer subscribers.Unlock()
+	s, ok := subscribers.m[msisdn]
+	return s, ok
+}
+
+// SetSubscribers replaces the subscriber database.
+func SetSubscribers(list []Subscriber) error {
+	m := make(map[string]Subscriber, len(list))
+	for _, s := range list {
+		if err := s.validate(); err != nil {
+			return err
+		}
+		m[s.MSISDN] = s
+	}
+	subscribers.Lock()
+	subscribers.m = m
+	subscribers.Unlock()
+	return nil
+}
+
+// LoadSubscribers replaces the subscriber database with the contents of a .csv or .json file.
+func LoadSubscribers(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "Opening subscribers failed")
+	}
+	defer f.Close()
+	var list []Subscriber
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.NewDecoder(f).Decode(&list)
+	} else {
+		list, err = ParseSubscribers(f)
+	}
+	if err != nil {
+		return errors.Wrap(err, "Reading subscribers failed")
+	}
+	return SetSubscribers(list)
+}
+
+// ParseSubscribers reads subscribers as CSV records of msisdn, state, and optionally network and delay in milliseconds.
+// A header line starting with msisdn is skipped.
+func ParseSubscribers(r io.Reader) ([]Subscriber, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]Subscriber, 0, len(records))
+	for i, rec := range records {
+		if len(rec) < 2 {
+			return nil, errors.Errorf("Line %d: expected msisdn and state", i+1)
+		}
+		if i == 0 && strings.EqualFold(rec[0], "msisdn") {
+			continue
+		}
+		s := Subscriber{MSISDN: rec[0], State: SubscriberState(rec[1])}
+		if len(rec) > 2 {
+			s.Network = rec[2]
+		}
+		if len(rec) > 3 && rec[3] != "" {
+			ms, err := strconv.Atoi(rec[3])
+			if err != nil {
+				return nil, errors.Errorf("Line %d: invalid delay %q", i+1, rec[3])
+			}
+			s.Delay = util.Delay{Value: ms}
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// outcome returns the delivery status, reason code and notification delay of a message
+// submitted by the account to the recipient.
+func outcome(conf util.Profile, account, recipient string) (dst, rsn string, delay time.Duration) {
+	s, ok := GetSubscriber(recipient)
+	if !ok {
+		return Delivered, reasonNone, deliveryDelay(conf, account, recipient, "")
+	}
+	network := ""
+	if s.State == SubscriberPorted {
+		network = s.Network
+	}
+	delay = deliveryDelay(conf, account, recipient, network)
+	if s.Delay != (util.Delay{}) {
+		delay = s.Delay.Duration()
+	}
+	switch s.State {
+	case SubscriberAbsent:
+		return Buffered, reasonAbsent, delay
+	case SubscriberMemoryFull:
+		return Buffered, reasonMemoryExceeded, delay
+	case SubscriberUnknown:
+		return NotDelivered, reasonUnknown, delay
+	}
+	return Delivered, reasonNone, delay
+}
+
+// deliveryDelay draws the delivery latency of a message from the first matching rule of the profile.
+// A rule limited to a network only matches recipients ported to it.
+func deliveryDelay(conf util.Profile, account, recipient, network string) time.Duration {
+	for _, d := range conf.DeliveryDelays {
+		switch {
+		case !strings.HasPrefix(recipient, d.Prefix):
+		case d.Account != "" && d.Account != account:
+		case d.Network != "" && d.Network != network:
+		default:
+			return d.Delay.Duration()
+		}
+	}
+	return time.Duration(conf.DNDelay) * time.Millisecond
+}
+
+// subscriberBarred returns true if the recipient is barred in the subscriber database.
+func subscriberBarred(recipient string) bool {
+	s, ok := GetSubscriber(recipient)
+	return ok && s.State == SubscriberBarred
+}
@@ -0,0 +1,54 @@
+package ucp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestOutcome(t *testing.T) {
+	conf := util.Profile{
+		DNDelay: 10,
+		DeliveryDelays: []util.DeliveryDelay{
+			{Prefix: "0917", Network: "globe", Delay: util.Delay{Value: 500}},
+			{Prefix: "0917", Account: "slow", Delay: util.Delay{Value: 300}},
+			{Prefix: "0917", Delay: util.Delay{Value: 100}},
+		},
+	}
+	for _, s := range []Subscriber{
+		{MSISDN: "09170000001", State: SubscriberPorted, Network: "globe"},
+		{MSISDN: "09170000002", State: SubscriberPorted, Network: "smart"},
+		{MSISDN: "09170000003", State: SubscriberAbsent, Network: "globe"},
+		{MSISDN: "09170000004", State: SubscriberUnknown},
+		{MSISDN: "09170000005", State: SubscriberPorted, Network: "globe", Delay: util.Delay{Value: 50}},
+	} {
+		if err := AddSubscriber(s); err != nil {
+			t.Fatal(err)
+		}
+		defer RemoveSubscriber(s.MSISDN)
+	}
+	tests := []struct {
+		name      string
+		account   string
+		recipient string
+		dst       string
+		rsn       string
+		delay     time.Duration
+	}{
+		{"not a subscriber", "user", "09170000000", Delivered, reasonNone, 100 * time.Millisecond},
+		{"not a subscriber, account rule", "slow", "09170000000", Delivered, reasonNone, 300 * time.Millisecond},
+		{"ported to a network with a rule", "user", "09170000001", Delivered, reasonNone, 500 * time.Millisecond},
+		{"ported to a network without a rule", "user", "09170000002", Delivered, reasonNone, 100 * time.Millisecond},
+		{"network of a subscriber not ported", "user", "09170000003", Buffered, reasonAbsent, 100 * time.Millisecond},
+		{"unknown", "user", "09170000004", NotDelivered, reasonUnknown, 100 * time.Millisecond},
+		{"subscriber delay", "user", "09170000005", Delivered, reasonNone, 50 * time.Millisecond},
+		{"no matching rule", "user", "09180000000", Delivered, reasonNone, 10 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		dst, rsn, delay := outcome(conf, tt.account, tt.recipient)
+		if dst != tt.dst || rsn != tt.rsn || delay != tt.delay {
+			t.Errorf("%s: outcome() = %s, %s, %v, want %s, %s, %v", tt.name, dst, rsn, delay, tt.dst, tt.rsn, tt.delay)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package ucp
+
+import (
+	"encoding/hex"
+	"strconv"
+)
+
+// maxUserData is the number of octets available for the user data of a single short message.
+const maxUserData = 140
+
+// Encoding is the alphabet of the short message user data.
+type Encoding int
+
+const (
+	// GSM7 is the GSM 7-bit default alphabet, measured in septets.
+	GSM7 Encoding = iota
+	// Octet is 8-bit data, measured in octets.
+	Octet
+	// UCS2 is 16-bit data, measured in characters.
+	UCS2
+)
+
+// String returns the name of the encoding.
+func (e Encoding) String() string {
+	switch e {
+	case Octet:
+		return "8-bit"
+	case UCS2:
+		return "UCS2"
+	default:
+		return "GSM 7-bit"
+	}
+}
+
+// MaxLen returns the number of units of the encoding that fit in a single short message
+// carrying a user data header of udhLen octets.
+func (e Encoding) MaxLen(udhLen int) int {
+	switch e {
+	case Octet:
+		return maxUserData - udhLen
+	case UCS2:
+		return (maxUserData - udhLen) / 2
+	default:
+		// the header is padded up to the next septet boundary
+		return (maxUserData*8 - udhLen*8) / 7
+	}
+}
+
+// dcsEncoding returns the alphabet indicated by a TP-DCS octet.
+func dcsEncoding(dcs byte) Encoding {
+	switch {
+	case dcs&0x80 == 0:
+		switch dcs & 0x0C {
+		case 0x04:
+			return Octet
+		case 0x08:
+			return UCS2
+		}
+	case dcs&0xF0 == 0xE0:
+		return UCS2
+	case dcs&0xF0 == 0xF0 && dcs&0x04 != 0:
+		return Octet
+	}
+	return GSM7
+}
+
+// Encoding returns the alphabet of the message based on MT, DCs and the DCS extra service.
+func (submit *Submit) Encoding() Encoding {
+	const (
+		NMsg = "2"
+		AMsg = "3"
+	)
+	switch string(submit.MT) {
+	case NMsg, AMsg:
+		return GSM7
+	}
+	if val, ok := submit.ParseXser()[DCS]; ok {
+		dcs, err := hex.DecodeString(val)
+		if err == nil && len(dcs) > 0 {
+			return dcsEncoding(dcs[0])
+		}
+	}
+	if string(submit.DCs) == "1" {
+		return Octet
+	}
+	return UCS2
+}
+
+// UDHLen returns the length in octets of the user data header, including the UDHL octet.
+func (submit *Submit) UDHLen() int {
+	return len(submit.ParseXser()[UDH]) / 2
+}
+
+// Len returns the length of the message in units of its encoding.
+func (submit *Submit) Len() int {
+	const (
+		NMsg = "2"
+		AMsg = "3"
+	)
+	switch string(submit.MT) {
+	case NMsg:
+		return len(submit.Msg)
+	case AMsg:
+		// every IRA octet is a septet of the GSM alphabet, see decodeIRA
+		return len(submit.Msg) / 2
+	}
+	octets := len(submit.Msg) / 2
+	if nb, err := strconv.Atoi(string(submit.NB)); err == nil && nb > 0 {
+		octets = (nb + 7) / 8
+	}
+	switch submit.Encoding() {
+	case GSM7:
+		if nb, err := strconv.Atoi(string(submit.NB)); err == nil && nb > 0 {
+			return nb / 7
+		}
+		return octets * 8 / 7
+	case UCS2:
+		return octets / 2
+	}
+	return octets
+}
+
+// IsTooLong returns true if the message and its user data header do not fit in a single short message.
+func (submit *Submit) IsTooLong() bool {
+	return submit.Len() > submit.Encoding().MaxLen(submit.UDHLen())
+}
+
+// Segments returns the number of segments of the concatenated message the submit is part of, or 1.
+func (submit *Submit) Segments() int {
+	const (
+		concat8  = 0x00
+		concat16 = 0x08
+	)
+	udh, err := hex.DecodeString(submit.ParseXser()[UDH])
+	if err != nil || len(udh) < 1 {
+		return 1
+	}
+	ies := udh[1:]
+	for len(ies) >= 2 {
+		iei, iel := ies[0], int(ies[1])
+		if len(ies) < 2+iel {
+			break
+		}
+		data := ies[2 : 2+iel]
+		switch {
+		case iei == concat8 && iel == 3 && data[1] > 0:
+			return int(data[1])
+		case iei == concat16 && iel == 4 && data[2] > 0:
+			return int(data[2])
+		}
+		ies = ies[2+iel:]
+	}
+	return 1
+}
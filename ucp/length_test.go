@@ -0,0 +1,108 @@
+package ucp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubmitLen(t *testing.T) {
+	const (
+		concatUDH = "0106050003AB0302"
+		ucs2DCS   = "020108"
+		gsm7DCS   = "020100"
+	)
+	tests := []struct {
+		name     string
+		submit   Submit
+		encoding Encoding
+		len      int
+		tooLong  bool
+	}{
+		{"IRA 160", Submit{MT: []byte("3"), Msg: []byte(strings.Repeat("41", 160))}, GSM7, 160, false},
+		{"IRA 161", Submit{MT: []byte("3"), Msg: []byte(strings.Repeat("41", 161))}, GSM7, 161, true},
+		{"IRA national characters", Submit{MT: []byte("3"), Msg: []byte(strings.Repeat("5B7E", 80))}, GSM7, 160, false},
+		{"IRA with UDH 153", Submit{MT: []byte("3"), Msg: []byte(strings.Repeat("41", 153)), Xser: []byte(concatUDH)}, GSM7, 153, false},
+		{"IRA with UDH 154", Submit{MT: []byte("3"), Msg: []byte(strings.Repeat("41", 154)), Xser: []byte(concatUDH)}, GSM7, 154, true},
+		{"numeric", Submit{MT: []byte("2"), Msg: []byte("12345")}, GSM7, 5, false},
+		{"NB 1120 bits", Submit{MT: []byte("4"), NB: []byte("1120"), Msg: []byte(strings.Repeat("00", 140)), Xser: []byte(gsm7DCS)}, GSM7, 160, false},
+		{"NB 1127 bits", Submit{MT: []byte("4"), NB: []byte("1127"), Msg: []byte(strings.Repeat("00", 141)), Xser: []byte(gsm7DCS)}, GSM7, 161, true},
+		{"UCS2 70", Submit{MT: []byte("4"), Msg: []byte(strings.Repeat("0041", 70)), Xser: []byte(ucs2DCS)}, UCS2, 70, false},
+		{"UCS2 71", Submit{MT: []byte("4"), Msg: []byte(strings.Repeat("0041", 71)), Xser: []byte(ucs2DCS)}, UCS2, 71, true},
+		{"UCS2 with UDH 67", Submit{MT: []byte("4"), Msg: []byte(strings.Repeat("0041", 67)), Xser: []byte(concatUDH + ucs2DCS)}, UCS2, 67, false},
+		{"UCS2 with UDH 68", Submit{MT: []byte("4"), Msg: []byte(strings.Repeat("0041", 68)), Xser: []byte(concatUDH + ucs2DCS)}, UCS2, 68, true},
+		{"8-bit 140", Submit{MT: []byte("4"), DCs: []byte("1"), Msg: []byte(strings.Repeat("FF", 140))}, Octet, 140, false},
+		{"8-bit 141", Submit{MT: []byte("4"), DCs: []byte("1"), Msg: []byte(strings.Repeat("FF", 141))}, Octet, 141, true},
+		{"UCS2 by default", Submit{MT: []byte("4"), Msg: []byte(strings.Repeat("0041", 10))}, UCS2, 10, false},
+	}
+	for _, tt := range tests {
+		if got := tt.submit.Encoding(); got != tt.encoding {
+			t.Errorf("%s: Encoding() = %v, want %v", tt.name, got, tt.encoding)
+		}
+		if got := tt.submit.Len(); got != tt.len {
+			t.Errorf("%s: Len() = %d, want %d", tt.name, got, tt.len)
+		}
+		if got := tt.submit.IsTooLong(); got != tt.tooLong {
+			t.Errorf("%s: IsTooLong() = %v, want %v", tt.name, got, tt.tooLong)
+		}
+	}
+}
+
+func TestEncodingMaxLen(t *testing.T) {
+	tests := []struct {
+		encoding Encoding
+		udhLen   int
+		max      int
+	}{
+		{GSM7, 0, 160},
+		{GSM7, 6, 153},
+		{GSM7, 7, 152},
+		{Octet, 0, 140},
+		{Octet, 6, 134},
+		{UCS2, 0, 70},
+		{UCS2, 6, 67},
+	}
+	for _, tt := range tests {
+		if got := tt.encoding.MaxLen(tt.udhLen); got != tt.max {
+			t.Errorf("%v.MaxLen(%d) = %d, want %d", tt.encoding, tt.udhLen, got, tt.max)
+		}
+	}
+}
+
+func TestDCSEncoding(t *testing.T) {
+	tests := []struct {
+		dcs      byte
+		encoding Encoding
+	}{
+		{0x00, GSM7},
+		{0x04, Octet},
+		{0x08, UCS2},
+		{0xE0, UCS2},
+		{0xF0, GSM7},
+		{0xF4, Octet},
+	}
+	for _, tt := range tests {
+		if got := dcsEncoding(tt.dcs); got != tt.encoding {
+			t.Errorf("dcsEncoding(%#02x) = %v, want %v", tt.dcs, got, tt.encoding)
+		}
+	}
+}
+
+func TestSubmitSegments(t *testing.T) {
+	tests := []struct {
+		xser     string
+		segments int
+	}{
+		{"", 1},
+		{"020108", 1},
+		{"0106050003AB0302", 3},
+		{"0107060804ABCD0502", 5},
+		{"0106050003AB0002", 1},
+		{"01030500", 1},
+	}
+	for _, tt := range tests {
+		s := Submit{Xser: []byte(tt.xser)}
+		if got := s.Segments(); got != tt.segments {
+			t.Errorf("Segments() with Xser %q = %d, want %d", tt.xser, got, tt.segments)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package ucp
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds in seconds of the response latency histogram.
+var latencyBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// histogram is a Prometheus histogram of observed durations.
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(latencyBuckets))
+	}
+	s := d.Seconds()
+	for i, le := range latencyBuckets {
+		if s <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += s
+}
+
+var metrics = struct {
+	sync.Mutex
+	// results are counted by operation type, ACK or NACK and error code
+	results       map[[3]string]uint64
+	notifications map[string]uint64
+	mo            uint64
+	bytesIn       uint64
+	bytesOut      uint64
+	latency       map[string]*histogram
+}{
+	results:       make(map[[3]string]uint64),
+	notifications: make(map[string]uint64),
+	latency:       make(map[string]*histogram),
+}
+
+// observeResult counts a result sent for an operation and the time taken to respond.
+func observeResult(operation string, res []byte, d time.Duration) {
+	fields := bytes.Split(bytes.Trim(res, "\x02\x03"), []byte("/"))
+	result, code := "", ""
+	if len(fields) > 4 {
+		result = string(fields[4])
+	}
+	if result == "N" && len(fields) > 5 {
+		code = string(fields[5])
+	}
+	metrics.Lock()
+	defer metrics.Unlock()
+	metrics.results[[3]string{operation, ackLabel(result), code}]++
+	h, ok := metrics.latency[operation]
+	if !ok {
+		h = &histogram{}
+		metrics.latency[operation] = h
+	}
+	h.observe(d)
+}
+
+func ackLabel(result string) string {
+	if result == "A" {
+		return "ACK"
+	}
+	return "NACK"
+}
+
+// observeNotification counts a delivery notification by its message status.
+func observeNotification(status string) {
+	metrics.Lock()
+	metrics.notifications[status]++
+	metrics.Unlock()
+}
+
+// ObserveMO counts a mobile originated message delivered to a client.
+func ObserveMO() {
+	metrics.Lock()
+	metrics.mo++
+	metrics.Unlock()
+}
+
+func observeBytes(in, out int) {
+	metrics.Lock()
+	metrics.bytesIn += uint64(in)
+	metrics.bytesOut += uint64(out)
+	metrics.Unlock()
+}
+
+// WriteMetrics writes the protocol metrics in the Prometheus text format.
+func WriteMetrics(w io.Writer) {
+	metrics.Lock()
+	defer metrics.Unlock()
+	fmt.Fprintln(w, "# HELP ucp_results_total Results sent for client operations.")
+	fmt.Fprintln(w, "# TYPE ucp_results_total counter")
+	keys := make([][3]string, 0, len(metrics.results))
+	for k := range metrics.results {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return strings.Join(keys[i][:], "/") < strings.Join(keys[j][:], "/")
+	})
+	for _, k := range keys {
+		fmt.Fprintf(w, "ucp_results_total{operation=%q,result=%q,error_code=%q} %d\n", k[0], k[1], k[2], metrics.results[k])
+	}
+	fmt.Fprintln(w, "# HELP ucp_delivery_notifications_total Delivery notifications sent by status.")
+	fmt.Fprintln(w, "# TYPE ucp_delivery_notifications_total counter")
+	for _, status := range []string{StatusDelivered, StatusBuffered, StatusFailed} {
+		fmt.Fprintf(w, "ucp_delivery_notifications_total{status=%q} %d\n", status, metrics.notifications[status])
+	}
+	fmt.Fprintln(w, "# HELP ucp_mo_messages_total Mobile originated messages delivered to clients.")
+	fmt.Fprintln(w, "# TYPE ucp_mo_messages_total counter")
+	fmt.Fprintf(w, "ucp_mo_messages_total %d\n", metrics.mo)
+	fmt.Fprintln(w, "# HELP ucp_received_bytes_total Bytes of frames received from clients.")
+	fmt.Fprintln(w, "# TYPE ucp_received_bytes_total counter")
+	fmt.Fprintf(w, "ucp_received_bytes_total %d\n", metrics.bytesIn)
+	fmt.Fprintln(w, "# HELP ucp_sent_bytes_total Bytes of frames sent to clients.")
+	fmt.Fprintln(w, "# TYPE ucp_sent_bytes_total counter")
+	fmt.Fprintf(w, "ucp_sent_bytes_total %d\n", metrics.bytesOut)
+	fmt.Fprintln(w, "# HELP ucp_response_latency_seconds Time from receiving an operation to sending its result.")
+	fmt.Fprintln(w, "# TYPE ucp_response_latency_seconds histogram")
+	ops := make([]string, 0, len(metrics.latency))
+	for op := range metrics.latency {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+	for _, op := range ops {
+		h := metrics.latency[op]
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "ucp_response_latency_seconds_bucket{operation=%q,le=%q} %d\n", op, strconv.FormatFloat(le, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "ucp_response_latency_seconds_bucket{operation=%q,le=\"+Inf\"} %d\n", op, h.count)
+		fmt.Fprintf(w, "ucp_response_latency_seconds_sum{operation=%q} %g\n", op, h.sum)
+		fmt.Fprintf(w, "ucp_response_latency_seconds_count{operation=%q} %d\n", op, h.count)
+	}
+}
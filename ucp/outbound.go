@@ -0,0 +1,82 @@
+package ucp
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// NPID of a notification address that is a TCP/IP address
+const notifyOverTCPIP = "0539"
+
+var outbound = struct {
+	sync.Mutex
+	conns []*Conn
+}{}
+
+// AddOutbound registers a connection opened by the server to a client endpoint.
+func AddOutbound(c *Conn) {
+	outbound.Lock()
+	outbound.conns = append(outbound.conns, c)
+	outbound.Unlock()
+}
+
+// RemoveOutbound unregisters an outbound connection.
+func RemoveOutbound(c *Conn) {
+	outbound.Lock()
+	defer outbound.Unlock()
+	for i := range outbound.conns {
+		if outbound.conns[i] == c {
+			outbound.conns = append(outbound.conns[:i], outbound.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// Outbound returns the registered outbound connections.
+func Outbound() []*Conn {
+	outbound.Lock()
+	defer outbound.Unlock()
+	return append([]*Conn{}, outbound.conns...)
+}
+
+// notificationConn returns the connection a delivery notification requested on conn is written to.
+// An outbound connection to the notification address is preferred, then one for the account.
+func notificationConn(conn *Conn, npid, nadc []byte) *Conn {
+	addr := ""
+	if string(npid) == notifyOverTCPIP {
+		addr = tcpipAddr(string(nadc))
+	}
+	var byAccount *Conn
+	for _, c := range Outbound() {
+		if c.Profile.Name != conn.Profile.Name {
+			continue
+		}
+		if addr != "" && c.RemoteAddr().String() == addr {
+			return c
+		}
+		if byAccount == nil && c.Account() == conn.Account() {
+			byAccount = c
+		}
+	}
+	if byAccount != nil {
+		return byAccount
+	}
+	return conn
+}
+
+// tcpipAddr converts a notification address to host:port.
+// The address is either host:port or twelve digits of IP address followed by the port.
+func tcpipAddr(nadc string) string {
+	if strings.Contains(nadc, ":") || len(nadc) <= 12 || !isNumeric([]byte(nadc)) {
+		return nadc
+	}
+	octets := make([]string, 4)
+	for i := range octets {
+		n, _ := strconv.Atoi(nadc[i*3 : i*3+3])
+		octets[i] = strconv.Itoa(n)
+	}
+	port, _ := strconv.Atoi(nadc[12:])
+	return fmt.Sprintf("%s:%d", strings.Join(octets, "."), port)
+}
@@ -7,36 +7,40 @@
 package ucp
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/hex"
 	"fmt"
 	"log"
-	"net"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/jcaberio/ucp-smsc-sim/event"
 	"github.com/jcaberio/ucp-smsc-sim/util"
 	"github.com/pkg/errors"
-	"gopkg.in/redis.v5"
 )
 
 const (
 	STX                      = 2
 	ETX                      = 3
+	CALL_INPUT_OP            = "01"
+	MULTIPLE_CALL_INPUT_OP   = "02"
+	SUPPLEMENTARY_SERVICE_OP = "03"
+	MESSAGE_TRANSFER_OP      = "30"
 	ALERT_OP                 = "31"
 	SUBMIT_SHORT_MESSAGE_OP  = "51"
 	DELIVER_SHORT_MESSAGE_OP = "52"
 	DELIVER_NOTIFICATION_OP  = "53"
 	SESSION_MANAGEMENT_OP    = "60"
+	LIST_MANAGEMENT_OP       = "61"
+	LIST_VERIFICATION_OP     = "62"
 )
 
 // PDU is a UCP protocol data unit.
 type PDU struct {
 	sync.Mutex
-	conn net.Conn
+	conn *Conn
 	// Transaction Reference Number
 	TransRefNum []byte
 	// PDU length
@@ -49,14 +53,23 @@ type PDU struct {
 	Data []byte
 	// PDU checksum
 	Checksum []byte
+	// raw is the frame the PDU was read from
+	raw []byte
+	// messageIDs are the ids of the messages stored for the operation
+	messageIDs []string
+	// received is when the PDU was read
+	received time.Time
 }
 
-// New creates a new PDU object.
-func New(r net.Conn) (pdu *PDU, err error) {
-	reader := bufio.NewReader(r)
-	raw, _ := reader.ReadSlice(ETX)
-	if len(raw) == 0 {
-		return pdu, errors.New("Empty packet")
+// New reads the next PDU from the connection.
+func New(r *Conn) (pdu *PDU, err error) {
+	raw, err := r.reader.ReadBytes(ETX)
+	if err != nil {
+		return pdu, errors.Wrap(err, "Reading packet failed")
+	}
+	logged := logFrame(r, DirectionIn, raw)
+	if len(raw) < 19 {
+		return pdu, errors.New("Packet too short")
 	}
 	if raw[0] != STX {
 		return pdu, errors.New("Invalid STX")
@@ -78,86 +91,329 @@ func New(r net.Conn) (pdu *PDU, err error) {
 		Operation:   OpType,
 		Data:        Data,
 		Checksum:    Checksum,
+		raw:         raw,
+		received:    time.Now(),
 	}
-	return pdu, err
+	observeBytes(len(raw), 0)
+	event.Publish(event.FrameReceived, frameEvent(logged))
+	return pdu, nil
 }
 
 // Decode sends a result PDU to the client.
-func (pdu *PDU) Decode(conf util.Config) {
+func (pdu *PDU) Decode(conf util.Profile) {
 	if pdu == nil {
 		return
 	}
 
+	if string(pdu.Type) == "R" {
+		pdu.acknowledge()
+		return
+	}
 	switch string(pdu.Operation) {
 	case ALERT_OP:
 		alert := NewAlert(pdu)
 		res := alert.Result()
-		client.Set(ResPacket, string(res), 30*time.Second)
-		pdu.Lock()
-		time.Sleep(time.Duration(GetKeepAliveTimeout()) * time.Second)
-		_, err := pdu.conn.Write(res)
-		SetKeepAliveTimeout(0)
-		pdu.Unlock()
-		if err != nil {
+		if code := alert.validate(); code != "" {
+			res = pdu.Nack(code)
+		}
+		fault := matchFault(ALERT_OP, pdu.conn, string(alert.AdC))
+		if err := pdu.respond(fault, res); err != nil {
 			log.Println("Writing ALERT failed: ", err)
 		}
 	case SUBMIT_SHORT_MESSAGE_OP:
 		sub := NewSubmit(pdu)
 		recipient := sub.GetRecipient()
+		if throttled(conf, pdu.conn.Account()) {
+			if err := pdu.respond(nil, pdu.Nack(throttleError(conf))); err != nil {
+				log.Println("Writing SM failed: ", err)
+			}
+			return
+		}
+		if code := acceptRecipient(conf, pdu.conn, sub.GetOriginator(), recipient); code != "" {
+			if err := pdu.respond(nil, pdu.Nack(code)); err != nil {
+				log.Println("Writing SM failed: ", err)
+			}
+			return
+		}
+		if sub.IsTooLong() {
+			if err := pdu.respond(nil, pdu.Nack(MessageTooLong)); err != nil {
+				log.Println("Writing SM failed: ", err)
+			}
+			return
+		}
+		fault := matchFault(SUBMIT_SHORT_MESSAGE_OP, pdu.conn, recipient)
+		if fault != nil && (fault.Action == FaultNack || fault.Action == FaultDrop) {
+			if err := pdu.respond(fault, nil); err != nil {
+				log.Println("Writing SM failed: ", err)
+			}
+			return
+		}
+		identifier, _ := hex.DecodeString(sub.ParseXser()[BillingIdentifier])
+		sub.SCTS = []byte(issueSCTS(recipient))
 		scts := sub.GetSCTS()
-
-		if val, ok := sub.ParseXser()[BillingIdentifier]; ok {
-			tariff, _ := hex.DecodeString(val)
-			cost := conf.Tariff[string(tariff)]
-			client.IncrByFloat(Cost, cost)
+		id := bill(conf, pdu, billable{
+			operation:  SUBMIT_SHORT_MESSAGE_OP,
+			account:    pdu.conn.Account(),
+			identifier: string(identifier),
+			originator: sub.GetOriginator(),
+			recipient:  recipient,
+			scts:       scts,
+			class:      string(sub.MCLs),
+			segments:   sub.Segments(),
+			message:    sub.GetMessage(),
+			encoding:   sub.Encoding(),
+		})
+		if id == "" {
+			if err := pdu.respond(nil, pdu.Nack(fundsError(conf))); err != nil {
+				log.Println("Writing SM failed: ", err)
+			}
+			return
 		}
-		if sub.IsNotifRequested() {
-			go func(pdu *PDU, recipient, scts string, client *redis.Client) {
-				time.Sleep(time.Duration(conf.DNDelay) * time.Millisecond)
-				dlvr := NewDeliverNotification(pdu, conf.AccessCode, recipient, scts)
-				res := dlvr.Result()
-				client.Set(ResPacket, string(res), 30*time.Second)
-				pdu.Lock()
-				_, err := pdu.conn.Write(dlvr.Result())
-				pdu.Unlock()
-				if err != nil {
-					log.Println("Writing DR failed: ", err)
-				}
-				client.HIncrBy(CountersKey, DrField, 1)
-			}(pdu, recipient, scts, client)
-		}
-		res := sub.Result()
-		client.Set(ResPacket, string(res), 30*time.Second)
-		pdu.Lock()
-		_, err := pdu.conn.Write(res)
-		pdu.Unlock()
-		if err != nil {
+		recordSubmit(sub)
+		if err := pdu.respond(fault, sub.Result()); err != nil {
 			log.Println("Writing SM failed: ", err)
 		}
+		if sub.IsNotifRequested() {
+			go notify(conf, pdu, notificationConn(pdu.conn, sub.NPID, sub.NAdC), id, recipient, scts)
+		}
+	case CALL_INPUT_OP:
+		ci := NewCallInput(pdu)
+		fault := matchFault(CALL_INPUT_OP, pdu.conn, string(ci.AdC))
+		if fault != nil && (fault.Action == FaultNack || fault.Action == FaultDrop) {
+			if err := pdu.respond(fault, nil); err != nil {
+				log.Println("Writing CALL INPUT failed: ", err)
+			}
+			return
+		}
+		if err := pdu.respond(fault, ci.handle(conf)); err != nil {
+			log.Println("Writing CALL INPUT failed: ", err)
+		}
+	case MULTIPLE_CALL_INPUT_OP:
+		mci := NewMultipleCallInput(pdu)
+		res, fault := mci.handle(conf)
+		if err := pdu.respond(fault, res); err != nil {
+			log.Println("Writing MULTIPLE CALL INPUT failed: ", err)
+		}
+	case SUPPLEMENTARY_SERVICE_OP:
+		ssci := NewSupplementaryCallInput(pdu)
+		fault := matchFault(SUPPLEMENTARY_SERVICE_OP, pdu.conn, string(ssci.AdC))
+		if fault != nil && (fault.Action == FaultNack || fault.Action == FaultDrop) {
+			if err := pdu.respond(fault, nil); err != nil {
+				log.Println("Writing SUPPLEMENTARY SERVICE CALL INPUT failed: ", err)
+			}
+			return
+		}
+		if err := pdu.respond(fault, ssci.handle(conf)); err != nil {
+			log.Println("Writing SUPPLEMENTARY SERVICE CALL INPUT failed: ", err)
+		}
+	case MESSAGE_TRANSFER_OP:
+		transfer := NewTransfer(pdu)
+		fault := matchFault(MESSAGE_TRANSFER_OP, pdu.conn, string(transfer.AdC))
+		if fault != nil && (fault.Action == FaultNack || fault.Action == FaultDrop) {
+			if err := pdu.respond(fault, nil); err != nil {
+				log.Println("Writing MESSAGE TRANSFER failed: ", err)
+			}
+			return
+		}
+		if err := pdu.respond(fault, transfer.handle(conf)); err != nil {
+			log.Println("Writing MESSAGE TRANSFER failed: ", err)
+		}
 	case DELIVER_NOTIFICATION_OP:
 	case DELIVER_SHORT_MESSAGE_OP:
 	case SESSION_MANAGEMENT_OP:
 		sesMngt := NewSession(pdu)
-		var res []byte
-		if sesMngt.GetOAdc() == conf.User && sesMngt.GetPassword() == conf.Password {
-			res = sesMngt.Result()
-		} else {
-			res = sesMngt.Error()
+		if err := pdu.respond(nil, sesMngt.handle(conf)); err != nil {
+			log.Println("Writing SESSION failed: ", err)
 		}
-		client.Set(ResPacket, string(res), 30*time.Second)
-		pdu.conn.Write(res)
 
+	case LIST_MANAGEMENT_OP, LIST_VERIFICATION_OP:
+		prov := NewProvisioning(pdu)
+		if err := pdu.respond(nil, prov.handle(conf)); err != nil {
+			log.Println("Writing PROVISIONING failed: ", err)
+		}
 	default:
 		log.Println("UNKNOWN OPERATION")
 	}
 }
 
+// acknowledge records the result the client returned for a delivery notification.
+func (pdu *PDU) acknowledge() {
+	if string(pdu.Operation) != DELIVER_NOTIFICATION_OP {
+		return
+	}
+	id, ok := pdu.conn.resolve(string(pdu.TransRefNum))
+	if !ok {
+		return
+	}
+	event := StatusDNAcked
+	if len(pdu.Data) == 0 || pdu.Data[0] != 'A' {
+		event = StatusDNNacked
+	}
+	addMessageEvent(id, event, pdu.raw)
+}
+
+// bill charges the account for one segment of a message, adds the cost to the totals and stores the message.
+// Each submit carries a single segment, so concatenated messages are billed per segment.
+// It returns the id of the stored message, or an empty string if the account is prepaid and cannot pay.
+func bill(conf util.Profile, pdu *PDU, b billable) string {
+	now := time.Now()
+	cost := rate(conf, b, now)
+	if !debit(conf, b.account, cost) {
+		return ""
+	}
+	identifier := b.identifier
+	if identifier == "" {
+		identifier = noIdentifier
+	}
+	client.IncrByFloat(Cost, cost)
+	client.HIncrByFloat(AccountCost, conf.Name+"/"+b.account, cost)
+	client.HIncrByFloat(IdentifierCost, identifier, cost)
+	WriteCDR(CDR{
+		Type:       CDRSubmit,
+		Profile:    conf.Name,
+		Account:    b.account,
+		Operation:  b.operation,
+		OAdC:       b.originator,
+		AdC:        b.recipient,
+		Identifier: b.identifier,
+		Cost:       cost,
+		Segments:   b.segments,
+		SCTS:       b.scts,
+	})
+	id := storeMessage(StoredMessage{
+		Profile:    conf.Name,
+		Account:    b.account,
+		Session:    pdu.conn.ID,
+		Operation:  b.operation,
+		Sender:     b.originator,
+		Recipient:  b.recipient,
+		Message:    b.message,
+		Encoding:   b.encoding.String(),
+		Segments:   b.segments,
+		Identifier: b.identifier,
+		Cost:       cost,
+		SCTS:       b.scts,
+		Received:   now,
+		PDUs:       []string{string(pdu.raw)},
+	})
+	pdu.messageIDs = append(pdu.messageIDs, id)
+	event.Publish(event.MessageAccepted, event.Message{
+		ID:        id,
+		Session:   pdu.conn.ID,
+		Account:   b.account,
+		Operation: b.operation,
+		Sender:    b.originator,
+		Recipient: b.recipient,
+		Message:   b.message,
+		Cost:      cost,
+	})
+	return id
+}
+
+// notify writes a delivery notification for the recipient to the connection.
+// The delay, status and reason depend on the recipient's entry in the subscriber database.
+// A buffered message is retried until the subscriber is reachable, when the final notification is written,
+// or until the retry period is over, when it fails with the reason it was buffered for.
+func notify(conf util.Profile, pdu *PDU, target *Conn, id, recipient, scts string) {
+	dst, rsn, delay := outcome(conf, pdu.conn.Account(), recipient)
+	time.Sleep(delay)
+	if !writeNotification(conf, pdu, target, id, recipient, scts, dst, rsn) || dst != Buffered {
+		return
+	}
+	interval, period := retryTimes(conf)
+	expiry := time.Now().Add(period)
+	for {
+		time.Sleep(interval)
+		if retry, reason, _ := outcome(conf, pdu.conn.Account(), recipient); retry != Buffered {
+			writeNotification(conf, pdu, target, id, recipient, scts, retry, reason)
+			return
+		}
+		if !time.Now().Before(expiry) {
+			writeNotification(conf, pdu, target, id, recipient, scts, NotDelivered, rsn)
+			return
+		}
+	}
+}
+
+// retryTimes returns the interval between delivery attempts of a buffered message and how long it is retried.
+func retryTimes(conf util.Profile) (interval, period time.Duration) {
+	interval, period = time.Minute, time.Hour
+	if conf.RetryInterval > 0 {
+		interval = time.Duration(conf.RetryInterval) * time.Second
+	}
+	if conf.RetryPeriod > 0 {
+		period = time.Duration(conf.RetryPeriod) * time.Second
+	}
+	return interval, period
+}
+
+// writeNotification writes a delivery notification with the given status and reason and records it.
+// Nothing is recorded about a notification that could not be written, and false is returned.
+func writeNotification(conf util.Profile, pdu *PDU, target *Conn, id, recipient, scts, dst, rsn string) bool {
+	dlvr := NewDeliverNotification(pdu, conf.AccessCode, recipient, scts)
+	dlvr.setStatus(dst, rsn)
+	trn, recorded := target.track(id)
+	dlvr.trn = trn
+	res := dlvr.Result()
+	client.Set(ResPacket, string(res), 30*time.Second)
+	if _, err := target.Write(res); err != nil {
+		recorded(false)
+		log.Println("Writing DR failed: ", err)
+		return false
+	}
+	setMessageStatus(id, dnStatus(dst), rsn, res)
+	recorded(true)
+	observeNotification(dnStatus(dst))
+	event.Publish(event.NotificationSent, event.Notification{
+		ID:        id,
+		Session:   target.ID,
+		Recipient: recipient,
+		Status:    dnStatus(dst),
+		Reason:    rsn,
+	})
+	client.HIncrBy(CountersKey, DrField, 1)
+	WriteCDR(CDR{
+		Type:      CDRNotification,
+		Profile:   conf.Name,
+		Account:   pdu.conn.Account(),
+		Operation: string(pdu.Operation),
+		OAdC:      conf.AccessCode,
+		AdC:       recipient,
+		SCTS:      scts,
+		Status:    dst,
+		Reason:    rsn,
+		Latency:   int64(time.Since(pdu.received) / time.Millisecond),
+	})
+	return true
+}
+
+// notifyAt writes a delivery notification like notify, but not before the deferred delivery time.
+func notifyAt(conf util.Profile, pdu *PDU, target *Conn, id, recipient, scts string, at time.Time) {
+	time.Sleep(time.Until(at))
+	notify(conf, pdu, target, id, recipient, scts)
+}
+
 // String returns the string representation of a PDU.
 func (pdu *PDU) String() string {
 	b := bytes.Join([][]byte{pdu.TransRefNum, pdu.Len, pdu.Type, pdu.Operation, pdu.Data, pdu.Checksum}, []byte("/"))
 	return string(b[:])
 }
 
+// trn returns the transaction reference number of the PDU.
+func (pdu *PDU) trn() int {
+	n, _ := strconv.Atoi(string(pdu.TransRefNum))
+	return n
+}
+
+// withTRN returns a copy of the frame with its transaction reference number replaced.
+func withTRN(frame []byte, trn int) []byte {
+	p := append([]byte{}, frame[1:len(frame)-3]...)
+	copy(p, fmt.Sprintf("%02d", trn))
+	b := append([]byte{STX}, p...)
+	b = append(b, checkSum(p)...)
+	return append(b, ETX)
+}
+
 // checkSum computes the checksum of the pdu
 func checkSum(b []byte) []byte {
 	var sum byte
@@ -0,0 +1,173 @@
+package ucp
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// List management types of operation 61
+const (
+	AddToMOList      = "1"
+	RemoveFromMOList = "2"
+	AddToMTList      = "3"
+	RemoveFromMTList = "4"
+)
+
+// List verification and parameter types of operation 62
+const (
+	VerifyMOList     = "1"
+	VerifyMTList     = "2"
+	EnableScreening  = "3"
+	DisableScreening = "4"
+)
+
+// maxListSize is the number of addresses a list can hold.
+const maxListSize = 1000
+
+// Provisioning is a List Management Operation(61) or a List Verification Operation(62).
+type Provisioning struct {
+	pdu  *PDU
+	OAdC []byte
+	OTON []byte
+	ONPI []byte
+	STYP []byte
+	PWD  []byte
+	NPWD []byte
+	VERS []byte
+	LAdC []byte
+	LTON []byte
+	LNPI []byte
+	RES1 []byte
+	RES2 []byte
+}
+
+// NewProvisioning creates a new Provisioning Operation PDU.
+func NewProvisioning(pdu *PDU) *Provisioning {
+	b := bytes.Split(pdu.Data, []byte("/"))
+	for len(b) < 12 {
+		b = append(b, []byte{})
+	}
+	return &Provisioning{
+		pdu:  pdu,
+		OAdC: b[0],
+		OTON: b[1],
+		ONPI: b[2],
+		STYP: b[3],
+		PWD:  b[4],
+		NPWD: b[5],
+		VERS: b[6],
+		LAdC: b[7],
+		LTON: b[8],
+		LNPI: b[9],
+		RES1: b[10],
+		RES2: b[11],
+	}
+}
+
+// addressLists are the addresses a large account is allowed to send from (MO) and to (MT).
+// Empty lists allow every address.
+type addressLists struct {
+	mo, mt map[string]bool
+	// unscreened disables the enforcement of the lists
+	unscreened bool
+}
+
+var provisioned = struct {
+	sync.Mutex
+	m map[string]*addressLists
+}{
+	m: make(map[string]*addressLists),
+}
+
+// listsOf returns the address lists of the account, the provisioned lock must be held.
+func listsOf(conf util.Profile, account string) *addressLists {
+	key := conf.Name + "/" + account
+	l, ok := provisioned.m[key]
+	if !ok {
+		l = &addressLists{mo: make(map[string]bool), mt: make(map[string]bool)}
+		provisioned.m[key] = l
+	}
+	return l
+}
+
+// barred returns true if the originator or the recipient is not in the provisioned lists of the account.
+func barred(conf util.Profile, account, originator, recipient string) bool {
+	provisioned.Lock()
+	defer provisioned.Unlock()
+	l := listsOf(conf, account)
+	if l.unscreened {
+		return false
+	}
+	return len(l.mo) > 0 && !l.mo[originator] || len(l.mt) > 0 && !l.mt[recipient]
+}
+
+// handle executes the operation on the lists of the session account and returns its result.
+func (p *Provisioning) handle(conf util.Profile) []byte {
+	if !p.pdu.conn.Provisioning() {
+		return p.pdu.Nack(OperationNotAllowed)
+	}
+	if string(p.OAdC) != p.pdu.conn.Account() {
+		return p.pdu.Nack(AuthenticationFailure)
+	}
+	addr := string(p.LAdC)
+	provisioned.Lock()
+	defer provisioned.Unlock()
+	l := listsOf(conf, p.pdu.conn.Account())
+	if string(p.pdu.Operation) == LIST_VERIFICATION_OP {
+		switch string(p.STYP) {
+		case VerifyMOList:
+			return p.verify(l.mo, addr)
+		case VerifyMTList:
+			return p.verify(l.mt, addr)
+		case EnableScreening:
+			l.unscreened = false
+			return p.pdu.ack("SCREENING ENABLED")
+		case DisableScreening:
+			l.unscreened = true
+			return p.pdu.ack("SCREENING DISABLED")
+		}
+		return p.pdu.Nack(SyntaxError)
+	}
+	if addr == "" {
+		return p.pdu.Nack(SyntaxError)
+	}
+	switch string(p.STYP) {
+	case AddToMOList:
+		return p.add(l.mo, addr)
+	case RemoveFromMOList:
+		return p.remove(l.mo, addr)
+	case AddToMTList:
+		return p.add(l.mt, addr)
+	case RemoveFromMTList:
+		return p.remove(l.mt, addr)
+	}
+	return p.pdu.Nack(SyntaxError)
+}
+
+func (p *Provisioning) add(list map[string]bool, addr string) []byte {
+	if list[addr] {
+		return p.pdu.Nack(AddressAlreadyInList)
+	}
+	if len(list) >= maxListSize {
+		return p.pdu.Nack(ListFull)
+	}
+	list[addr] = true
+	return p.pdu.ack(addr + " ADDED")
+}
+
+func (p *Provisioning) remove(list map[string]bool, addr string) []byte {
+	if !list[addr] {
+		return p.pdu.Nack(AddressNotInList)
+	}
+	delete(list, addr)
+	return p.pdu.ack(addr + " REMOVED")
+}
+
+func (p *Provisioning) verify(list map[string]bool, addr string) []byte {
+	if !list[addr] {
+		return p.pdu.Nack(AddressNotInList)
+	}
+	return p.pdu.ack(addr + " IN LIST")
+}
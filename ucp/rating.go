@@ -0,0 +1,72 @@
+package ucp
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+var (
+	// AccountCost is a redis hash of the message cost per profile and account
+	AccountCost = "cost_account_" + Suffix
+	// IdentifierCost is a redis hash of the message cost per billing identifier
+	IdentifierCost = "cost_identifier_" + Suffix
+)
+
+// noIdentifier is the IdentifierCost field of messages without a billing identifier
+const noIdentifier = "none"
+
+// billable is a message segment to be rated.
+type billable struct {
+	operation  string
+	account    string
+	identifier string
+	originator string
+	recipient  string
+	scts       string
+	// class is the message class, empty if not given
+	class string
+	// segments is the number of segments of the concatenated message
+	segments int
+	message  string
+	encoding Encoding
+}
+
+// rate returns the price of one segment of the message at the given time.
+// The first matching rate rule applies, then the tariff of the billing identifier, then the default rate.
+func rate(conf util.Profile, b billable, now time.Time) float64 {
+	for _, r := range conf.Rates {
+		switch {
+		case r.Identifier != "" && r.Identifier != b.identifier:
+		case !strings.HasPrefix(b.recipient, r.Prefix):
+		case b.segments < r.MinSegments:
+		case r.Class != "" && r.Class != b.class:
+		case !inBand(r.From, r.To, now):
+		default:
+			return r.Price
+		}
+	}
+	if price, ok := conf.Tariff[b.identifier]; ok {
+		return price
+	}
+	return conf.DefaultRate
+}
+
+// inBand returns true if the time of day is within the band from-to in HH:MM.
+// A band ending before it starts wraps around midnight, and an empty bound is open.
+func inBand(from, to string, now time.Time) bool {
+	if from == "" && to == "" {
+		return true
+	}
+	clock := now.Format("15:04")
+	switch {
+	case from == "":
+		return clock < to
+	case to == "":
+		return clock >= from
+	case from <= to:
+		return clock >= from && clock < to
+	}
+	return clock >= from || clock < to
+}
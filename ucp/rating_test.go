@@ -0,0 +1,80 @@
+package ucp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestInBand(t *testing.T) {
+	at := func(clock string) time.Time {
+		tm, err := time.Parse("15:04", clock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		from, to, now string
+		want          bool
+	}{
+		{"", "", "12:00", true},
+		{"08:00", "18:00", "08:00", true},
+		{"08:00", "18:00", "17:59", true},
+		{"08:00", "18:00", "18:00", false},
+		{"08:00", "18:00", "07:59", false},
+		{"22:00", "06:00", "23:30", true},
+		{"22:00", "06:00", "00:00", true},
+		{"22:00", "06:00", "05:59", true},
+		{"22:00", "06:00", "06:00", false},
+		{"22:00", "06:00", "12:00", false},
+		{"", "06:00", "05:00", true},
+		{"", "06:00", "06:00", false},
+		{"22:00", "", "21:59", false},
+		{"22:00", "", "23:59", true},
+	}
+	for _, tt := range tests {
+		if got := inBand(tt.from, tt.to, at(tt.now)); got != tt.want {
+			t.Errorf("inBand(%q, %q, %s) = %v, want %v", tt.from, tt.to, tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestRate(t *testing.T) {
+	conf := util.Profile{
+		Rates: []util.Rate{
+			{Identifier: "promo", Price: 0},
+			{Prefix: "0917", Class: "0", Price: 0.2},
+			{Prefix: "0917", MinSegments: 3, Price: 0.3},
+			{Prefix: "0918", From: "22:00", To: "06:00", Price: 0.1},
+			{Prefix: "0917", Price: 0.5},
+		},
+		Tariff:      map[string]float64{"premium": 2.5},
+		DefaultRate: 1,
+	}
+	day := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2026, 10, 19, 23, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		b     billable
+		now   time.Time
+		price float64
+	}{
+		{"identifier rule", billable{identifier: "promo", recipient: "0917", segments: 1}, day, 0},
+		{"class rule", billable{recipient: "09171", class: "0", segments: 1}, day, 0.2},
+		{"other class", billable{recipient: "09171", class: "1", segments: 1}, day, 0.5},
+		{"segments rule", billable{recipient: "09171", segments: 3}, day, 0.3},
+		{"too few segments", billable{recipient: "09171", segments: 2}, day, 0.5},
+		{"time band", billable{recipient: "09181", segments: 1}, night, 0.1},
+		{"outside time band", billable{recipient: "09181", segments: 1}, day, 1},
+		{"tariff", billable{identifier: "premium", recipient: "0919", segments: 1}, day, 2.5},
+		{"rule before tariff", billable{identifier: "premium", recipient: "0917", segments: 1}, day, 0.5},
+		{"default rate", billable{recipient: "0919", segments: 1}, day, 1},
+	}
+	for _, tt := range tests {
+		if got := rate(conf, tt.b, tt.now); got != tt.price {
+			t.Errorf("%s: rate() = %v, want %v", tt.name, got, tt.price)
+		}
+	}
+}
@@ -4,8 +4,30 @@ import (
 	"bytes"
 	"encoding/hex"
 	"fmt"
+	"sync"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// Session types
+const (
+	OpenSession             = "1"
+	ChangePassword          = "3"
+	OpenProvisioningSession = "4"
+	ChangeProvisioningPwd   = "6"
 )
 
+// supportedVersion is the only accepted UCP version, assumed if VERS is empty
+const supportedVersion = "0100"
+
+// passwords are the account passwords changed during the run, keyed by profile and user.
+var passwords = struct {
+	sync.Mutex
+	m map[string]string
+}{
+	m: make(map[string]string),
+}
+
 // Session is a Session Management Operation(60).
 type Session struct {
 	pdu  *PDU
@@ -26,6 +48,9 @@ type Session struct {
 // NewSession creates a new Session Management Operation PDU.
 func NewSession(pdu *PDU) *Session {
 	b := bytes.Split(pdu.Data, []byte("/"))
+	for len(b) < 12 {
+		b = append(b, []byte{})
+	}
 	return &Session{
 		pdu:  pdu,
 		OAdC: b[0],
@@ -49,6 +74,60 @@ func (s *Session) GetPassword() string {
 	return string(pw[:])
 }
 
+// GetNewPassword returns the decoded new password, or false if it is not valid IRA.
+func (s *Session) GetNewPassword() (string, bool) {
+	pw, err := hex.DecodeString(string(s.NPWD))
+	return string(pw), err == nil && len(pw) > 0
+}
+
+// authenticate returns true if the originator and password match an account of the profile.
+func (s *Session) authenticate(conf util.Profile) bool {
+	acc, ok := conf.Account(s.GetOAdc())
+	if !ok {
+		return false
+	}
+	passwords.Lock()
+	defer passwords.Unlock()
+	if pw, ok := passwords.m[conf.Name+"/"+acc.User]; ok {
+		return s.GetPassword() == pw
+	}
+	return s.GetPassword() == acc.Password
+}
+
+// handle executes the operation and returns its result.
+func (s *Session) handle(conf util.Profile) []byte {
+	if len(s.VERS) > 0 && string(s.VERS) != supportedVersion {
+		return s.pdu.Nack(SyntaxError)
+	}
+	switch string(s.STYP) {
+	case OpenSession, OpenProvisioningSession, ChangePassword:
+	case ChangeProvisioningPwd:
+		return s.pdu.Nack(OperationNotSupported)
+	default:
+		return s.pdu.Nack(SyntaxError)
+	}
+	if !s.authenticate(conf) {
+		return s.Error()
+	}
+	switch string(s.STYP) {
+	case ChangePassword:
+		pw, ok := s.GetNewPassword()
+		if !ok {
+			return s.pdu.Nack(NewACNotValid)
+		}
+		passwords.Lock()
+		passwords.m[conf.Name+"/"+s.GetOAdc()] = pw
+		passwords.Unlock()
+		return s.ack("PASSWORD CHANGED")
+	case OpenProvisioningSession:
+		s.pdu.conn.Bind(s.GetOAdc())
+		s.pdu.conn.setProvisioning()
+		return s.ack("PROVISIONING SESSION AUTHENTICATED")
+	}
+	s.pdu.conn.Bind(s.GetOAdc())
+	return s.Result()
+}
+
 func (s *Session) GetStyp() string {
 	switch string(s.STYP[:]) {
 	case "1":
@@ -96,18 +175,32 @@ func (s *Session) GetONPI() string {
 	}
 }
 
-// Result returns a Session Management Operation Result.
-func (s *Session) Result() []byte {
+// Login returns a Session Management Operation opening a session as the given user.
+func Login(trn int, user, password string) []byte {
 	b := make([]byte, 0)
 	b = append(b, STX)
-	systemMsg := "BIND AUTHENTICATED"
-	Len := 19 + len(systemMsg)
+	data := [][]byte{
+		[]byte(user),
+		[]byte("6"),
+		[]byte("5"),
+		[]byte("1"),
+		[]byte(hex.EncodeToString([]byte(password))),
+		[]byte(""),
+		[]byte("0100"),
+		[]byte(""),
+		[]byte(""),
+		[]byte(""),
+		[]byte(""),
+		[]byte(""),
+	}
+	bdata := bytes.Join(data, []byte("/"))
+	Len := 17 + len(bdata)
 	partial := [][]byte{
-		s.pdu.TransRefNum,
+		[]byte(fmt.Sprintf("%02d", trn)),
 		[]byte(fmt.Sprintf("%05d", Len)),
-		[]byte("R"), s.pdu.Operation,
-		[]byte("A"),
-		[]byte(systemMsg),
+		[]byte("O"),
+		[]byte(SESSION_MANAGEMENT_OP),
+		bdata,
 	}
 	p := append(bytes.Join(partial, []byte("/")), []byte("/")...)
 	chksum := checkSum(p)
@@ -117,24 +210,17 @@ func (s *Session) Result() []byte {
 	return b
 }
 
+// Result returns a Session Management Operation Result.
+func (s *Session) Result() []byte {
+	return s.ack("BIND AUTHENTICATED")
+}
+
+// ack returns a Positive Acknowledgement Result with the given system message.
+func (s *Session) ack(systemMsg string) []byte {
+	return s.pdu.ack(systemMsg)
+}
+
 // Error returns a Negative Acknowledgement Result.
 func (s *Session) Error() []byte {
-	b := make([]byte, 0)
-	b = append(b, STX)
-	systemMsg := "AUTHENTICATION FAILURE"
-	Len := 22 + len(systemMsg)
-	partial := [][]byte{
-		s.pdu.TransRefNum,
-		[]byte(fmt.Sprintf("%05d", Len)),
-		[]byte("R"), s.pdu.Operation,
-		[]byte("N"),
-		[]byte("07"),
-		[]byte(systemMsg),
-	}
-	p := append(bytes.Join(partial, []byte("/")), []byte("/")...)
-	chksum := checkSum(p)
-	result := append(p, chksum...)
-	b = append(b, result...)
-	b = append(b, ETX)
-	return b
+	return s.pdu.Nack(AuthenticationFailure)
 }
@@ -3,7 +3,6 @@ package ucp
 import (
 	"encoding/hex"
 	"encoding/json"
-	"sync"
 	"time"
 
 	"github.com/go-gsm/charset"
@@ -24,8 +23,6 @@ var (
 	DrField = "deliver_sm_" + Suffix
 	// TpsKey is a redis key for tps
 	TpsKey = "tps_" + Suffix
-	// ActiveConnection is a redis key for sorted set of active connections
-	ActiveConnection = "active_conn_" + Suffix
 	// ReqPacket is a redis key for incoming tcp packet
 	ReqPacket = "req_packet_" + Suffix
 	// ResPacket is a redis key for outgoing tcp packet
@@ -43,73 +40,59 @@ var (
 		Password: "",
 		DB:       0,
 	})
-	tpsCounter       = ratecounter.NewRateCounter(1 * time.Second)
-	mu               sync.Mutex
-	KeepAliveTimeout = 0
+	tpsCounter = ratecounter.NewRateCounter(1 * time.Second)
 )
 
-func SetKeepAliveTimeout(n int) {
-	mu.Lock()
-	KeepAliveTimeout = n
-	mu.Unlock()
-}
-
-func GetKeepAliveTimeout() int {
-	mu.Lock()
-	defer mu.Unlock()
-	return KeepAliveTimeout
-
-}
-
 // Stats updates the Stats display in the web UI.
 func (pdu *PDU) Stats() {
 	client.Set(ReqPacket, pdu.String(), 30*time.Second)
-	switch string(pdu.Operation) {
-	case SUBMIT_SHORT_MESSAGE_OP:
-		tpsCounter.Incr(1)
-		client.Set(TpsKey, tpsCounter.Rate(), 1*time.Second)
-		client.HIncrBy(CountersKey, SmField, 1)
-		submitPdu := NewSubmit(pdu)
-		shortMessage := submitPdu.GetMessage()
-		source := string(submitPdu.OAdC)
-		destination := string(submitPdu.AdC)
-		decodedSrc, _ := hex.DecodeString(source)
-		unpacked := charset.Unpack7Bit(decodedSrc[1:])
-		src, _ := charset.Decode7Bit(unpacked)
-		if val, ok := submitPdu.ParseXser()[UDH]; ok {
-			RefNum = val[len(val)-6 : len(val)-4]
-			msgPartsLen := val[len(val)-4 : len(val)-2]
-			msgPart := val[len(val)-2:]
-			lastMsg := client.HGet(RefNum, "message").Val()
-			client.HMSet(RefNum, map[string]string{
-				"total_parts":      msgPartsLen,
-				"current_part_num": msgPart,
-				"message":          lastMsg + shortMessage,
-			})
-			total_parts := client.HGet(RefNum, "total_parts").Val()
-			current_part_num := client.HGet(RefNum, "current_part_num").Val()
-			if total_parts == current_part_num {
-				shortMessage = client.HGet(RefNum, "message").Val()
-				wsMsg := util.Message{Message: shortMessage, Sender: src, Recipient: destination, Timestamp: time.Now().String()}
-				save(wsMsg)
-				client.Del(RefNum)
-			}
-		} else {
+}
+
+// recordSubmit counts a submit accepted by the SMSC and saves it to the message list,
+// once all the parts of a concatenated message have arrived.
+func recordSubmit(submitPdu *Submit) {
+	tpsCounter.Incr(1)
+	client.Set(TpsKey, tpsCounter.Rate(), 1*time.Second)
+	client.HIncrBy(CountersKey, SmField, 1)
+	shortMessage := submitPdu.GetMessage()
+	source := string(submitPdu.OAdC)
+	destination := string(submitPdu.AdC)
+	decodedSrc, _ := hex.DecodeString(source)
+	unpacked := charset.Unpack7Bit(decodedSrc[1:])
+	src, _ := charset.Decode7Bit(unpacked)
+	if val, ok := submitPdu.ParseXser()[UDH]; ok {
+		RefNum = val[len(val)-6 : len(val)-4]
+		msgPartsLen := val[len(val)-4 : len(val)-2]
+		msgPart := val[len(val)-2:]
+		lastMsg := client.HGet(RefNum, "message").Val()
+		client.HMSet(RefNum, map[string]string{
+			"total_parts":      msgPartsLen,
+			"current_part_num": msgPart,
+			"message":          lastMsg + shortMessage,
+		})
+		total_parts := client.HGet(RefNum, "total_parts").Val()
+		current_part_num := client.HGet(RefNum, "current_part_num").Val()
+		if total_parts == current_part_num {
+			shortMessage = client.HGet(RefNum, "message").Val()
 			wsMsg := util.Message{Message: shortMessage, Sender: src, Recipient: destination, Timestamp: time.Now().String()}
 			save(wsMsg)
+			client.Del(RefNum)
 		}
-		client.HMSet(IpSrcDstMsg, map[string]string{
-			pdu.conn.RemoteAddr().String(): src + "_" + destination + "_" + shortMessage,
-		})
-	case ALERT_OP:
-		nextMinute := time.Now().Add(1 * time.Minute).Unix()
-		client.ZAdd(ActiveConnection,
-			redis.Z{
-				Score:  float64(nextMinute),
-				Member: pdu.conn.RemoteAddr().String(),
-			},
-		)
+	} else {
+		wsMsg := util.Message{Message: shortMessage, Sender: src, Recipient: destination, Timestamp: time.Now().String()}
+		save(wsMsg)
 	}
+	client.HMSet(IpSrcDstMsg, map[string]string{
+		submitPdu.pdu.conn.RemoteAddr().String(): src + "_" + destination + "_" + shortMessage,
+	})
+}
+
+// record counts a message accepted by a call input or transfer operation and saves it to the message list.
+func record(src, destination, shortMessage string) {
+	tpsCounter.Incr(1)
+	client.Set(TpsKey, tpsCounter.Rate(), 1*time.Second)
+	client.HIncrBy(CountersKey, SmField, 1)
+	save(util.Message{Message: shortMessage, Sender: src, Recipient: destination, Timestamp: time.Now().String()})
 }
 
 func save(wsMsg util.Message) {
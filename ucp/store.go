@@ -0,0 +1,345 @@
+package ucp
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/redis.v5"
+)
+
+// The message store is kept across restarts, unlike the per-run keys suffixed with Suffix,
+// until the messages are older than the configured retention.
+var (
+	// Messages is a redis hash of every accepted message by id
+	Messages = "ucp_messages"
+	// MessageIndex is a redis sorted set of message ids scored by the time they were received
+	MessageIndex = "ucp_message_index"
+)
+
+// Message statuses
+const (
+	StatusAccepted  = "accepted"
+	StatusDelivered = "delivered"
+	StatusBuffered  = "buffered"
+	StatusFailed    = "failed"
+)
+
+// Message events that do not change the status
+const (
+	StatusDNAcked  = "dn_acked"
+	StatusDNNacked = "dn_nacked"
+)
+
+// StatusChange is an entry of the status history of a message, which is its lifecycle timeline.
+type StatusChange struct {
+	Status string    `json:"status"`
+	Time   time.Time `json:"time"`
+	// Reason is the reason code of a delivery notification
+	Reason string `json:"reason,omitempty"`
+}
+
+// StoredMessage is a message accepted by the simulator.
+type StoredMessage struct {
+	// ID is the AdC:SCTS returned to the client
+	ID         string         `json:"id"`
+	Profile    string         `json:"profile"`
+	Account    string         `json:"account"`
+	Session    string         `json:"session"`
+	Operation  string         `json:"operation"`
+	Sender     string         `json:"sender"`
+	Recipient  string         `json:"recipient"`
+	Message    string         `json:"message"`
+	Encoding   string         `json:"encoding"`
+	Segments   int            `json:"segments"`
+	Identifier string         `json:"identifier"`
+	Cost       float64        `json:"cost"`
+	SCTS       string         `json:"scts"`
+	Received   time.Time      `json:"received"`
+	Status     string         `json:"status"`
+	History    []StatusChange `json:"history"`
+	// PDUs are the raw operation, its result and the delivery notification
+	PDUs []string `json:"pdus"`
+}
+
+// MessageFilter selects stored messages. Empty fields match all messages.
+type MessageFilter struct {
+	Recipient string
+	Sender    string
+	From      time.Time
+	To        time.Time
+	// Contains is a substring of the message text
+	Contains string
+	Status   string
+	Offset   int
+	// Limit is the maximum number of messages returned, all if zero
+	Limit int
+}
+
+// storeMu serializes read-modify-write updates of stored messages.
+var storeMu sync.Mutex
+
+// sctsLayout is the time format of service centre time stamps
+const sctsLayout = "020106150405"
+
+// issued is the latest SCTS given out for each recipient.
+var issued = struct {
+	sync.Mutex
+	m map[string]time.Time
+	// loaded is true once the stamps of the messages stored by a previous run are taken into account
+	loaded bool
+}{m: make(map[string]time.Time)}
+
+// issueSCTS returns a service centre time stamp for a message to the recipient.
+// The stamp is the current second, or a later one if that second was already given out for the recipient,
+// so that every AdC:SCTS identifies a single message.
+func issueSCTS(recipient string) string {
+	issued.Lock()
+	defer issued.Unlock()
+	now := time.Now().Truncate(time.Second)
+	if !issued.loaded {
+		loadIssued(now)
+		issued.loaded = true
+	}
+	if len(issued.m) > 10000 {
+		for r, t := range issued.m {
+			if t.Before(now) {
+				delete(issued.m, r)
+			}
+		}
+	}
+	t := now
+	if last, ok := issued.m[recipient]; ok && !last.Before(t) {
+		t = last.Add(time.Second)
+	}
+	issued.m[recipient] = t
+	return t.Format(sctsLayout)
+}
+
+// loadIssued remembers the stamps of the messages stored during the last minute,
+// which a previous run may have given out ahead of the current second.
+func loadIssued(now time.Time) {
+	min := strconv.FormatInt(now.Add(-time.Minute).UnixNano(), 10)
+	for _, id := range client.ZRangeByScore(MessageIndex, redis.ZRangeBy{Min: min, Max: "+inf"}).Val() {
+		i := strings.LastIndex(id, ":")
+		if i < 0 {
+			continue
+		}
+		t, err := time.ParseInLocation(sctsLayout, id[i+1:], time.Local)
+		if err == nil && t.After(issued.m[id[:i]]) {
+			issued.m[id[:i]] = t
+		}
+	}
+}
+
+// recipientIndex is the redis sorted set of the ids of the messages to the recipient, scored like MessageIndex.
+func recipientIndex(recipient string) string {
+	return MessageIndex + ":recipient:" + recipient
+}
+
+// senderIndex is the redis sorted set of the ids of the messages from the sender, scored like MessageIndex.
+func senderIndex(sender string) string {
+	return MessageIndex + ":sender:" + sender
+}
+
+// storeMessage saves a new message and returns its id, AdC:SCTS.
+func storeMessage(m StoredMessage) string {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	m.ID = m.Recipient + ":" + m.SCTS
+	m.Status = StatusAccepted
+	m.History = []StatusChange{{Status: StatusAccepted, Time: m.Received}}
+	b, _ := json.Marshal(&m)
+	client.HSet(Messages, m.ID, string(b))
+	z := redis.Z{Score: float64(m.Received.UnixNano()), Member: m.ID}
+	client.ZAdd(MessageIndex, z)
+	client.ZAdd(recipientIndex(m.Recipient), z)
+	client.ZAdd(senderIndex(m.Sender), z)
+	return m.ID
+}
+
+// defaultMessageRetention is how long messages are stored if not configured
+const defaultMessageRetention = 24 * time.Hour
+
+// InitMessageStore deletes the stored messages older than the given number of hours, every minute.
+func InitMessageStore(hours int) {
+	retention := time.Duration(hours) * time.Hour
+	if retention <= 0 {
+		retention = defaultMessageRetention
+	}
+	go func() {
+		for {
+			pruneMessages(strconv.FormatInt(time.Now().Add(-retention).UnixNano(), 10))
+			time.Sleep(time.Minute)
+		}
+	}()
+}
+
+// ClearMessages deletes every stored message.
+func ClearMessages() {
+	pruneMessages("+inf")
+}
+
+// pruneMessages deletes the messages received before the score max, together with their index entries.
+func pruneMessages(max string) {
+	for {
+		storeMu.Lock()
+		ids := client.ZRangeByScore(MessageIndex, redis.ZRangeBy{Min: "-inf", Max: max, Count: findBatch}).Val()
+		if len(ids) == 0 {
+			storeMu.Unlock()
+			return
+		}
+		members := make([]interface{}, len(ids))
+		for i, id := range ids {
+			members[i] = id
+		}
+		for _, m := range loadMessages(ids) {
+			client.ZRem(recipientIndex(m.Recipient), m.ID)
+			client.ZRem(senderIndex(m.Sender), m.ID)
+		}
+		client.HDel(Messages, ids...)
+		client.ZRem(MessageIndex, members...)
+		storeMu.Unlock()
+	}
+}
+
+// updateMessage applies fn to the stored message with the given id.
+func updateMessage(id string, fn func(*StoredMessage)) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	m, ok := GetMessage(id)
+	if !ok {
+		return
+	}
+	fn(&m)
+	b, _ := json.Marshal(&m)
+	client.HSet(Messages, id, string(b))
+}
+
+// appendPDU adds a raw PDU to the stored message.
+func appendPDU(id string, pdu []byte) {
+	updateMessage(id, func(m *StoredMessage) {
+		m.PDUs = append(m.PDUs, string(pdu))
+	})
+}
+
+// setMessageStatus records a status change of the stored message.
+func setMessageStatus(id, status, reason string, pdu []byte) {
+	updateMessage(id, func(m *StoredMessage) {
+		m.Status = status
+		m.History = append(m.History, StatusChange{Status: status, Time: time.Now(), Reason: reason})
+		m.PDUs = append(m.PDUs, string(pdu))
+	})
+}
+
+// addMessageEvent records an event in the status history of the stored message without changing its status.
+func addMessageEvent(id, event string, pdu []byte) {
+	updateMessage(id, func(m *StoredMessage) {
+		m.History = append(m.History, StatusChange{Status: event, Time: time.Now()})
+		m.PDUs = append(m.PDUs, string(pdu))
+	})
+}
+
+// GetMessage returns the stored message with the given id.
+func GetMessage(id string) (StoredMessage, bool) {
+	var m StoredMessage
+	val, err := client.HGet(Messages, id).Result()
+	if err != nil || json.Unmarshal([]byte(val), &m) != nil {
+		return m, false
+	}
+	return m, true
+}
+
+// findBatch is the number of messages loaded at a time when a filter has to look at their contents
+const findBatch = 500
+
+// FindMessages returns the stored messages matching the filter, newest first, and the number of matches.
+// The messages are looked up in the index of the recipient or sender if the filter has one, else in MessageIndex.
+// Only the requested page is loaded unless the filter selects by other fields.
+func FindMessages(f MessageFilter) ([]StoredMessage, int) {
+	opt := redis.ZRangeBy{Min: "-inf", Max: "+inf"}
+	if !f.From.IsZero() {
+		opt.Min = strconv.FormatInt(f.From.UnixNano(), 10)
+	}
+	if !f.To.IsZero() {
+		opt.Max = "(" + strconv.FormatInt(f.To.UnixNano(), 10)
+	}
+	index := MessageIndex
+	switch {
+	case f.Recipient != "":
+		index = recipientIndex(f.Recipient)
+	case f.Sender != "":
+		index = senderIndex(f.Sender)
+	}
+	if f.Status == "" && f.Contains == "" && (f.Recipient == "" || f.Sender == "") {
+		total := int(client.ZCount(index, opt.Min, opt.Max).Val())
+		opt.Offset, opt.Count = int64(f.Offset), int64(f.Limit)
+		if f.Limit == 0 {
+			// a negative count returns every message from the offset
+			opt.Count = -1
+		}
+		return loadMessages(client.ZRevRangeByScore(index, opt).Val()), total
+	}
+	matches := make([]StoredMessage, 0)
+	total := 0
+	for opt.Offset, opt.Count = 0, findBatch; ; opt.Offset += findBatch {
+		ids := client.ZRevRangeByScore(index, opt).Val()
+		for _, m := range loadMessages(ids) {
+			if !f.match(m) {
+				continue
+			}
+			if total >= f.Offset && (f.Limit == 0 || len(matches) < f.Limit) {
+				matches = append(matches, m)
+			}
+			total++
+		}
+		if len(ids) < findBatch {
+			return matches, total
+		}
+	}
+}
+
+// match returns true if the message matches the recipient, sender, status and contents of the filter.
+func (f MessageFilter) match(m StoredMessage) bool {
+	switch {
+	case f.Recipient != "" && m.Recipient != f.Recipient:
+	case f.Sender != "" && m.Sender != f.Sender:
+	case f.Status != "" && m.Status != f.Status:
+	case !strings.Contains(m.Message, f.Contains):
+	default:
+		return true
+	}
+	return false
+}
+
+// loadMessages returns the stored messages with the given ids, in the same order.
+func loadMessages(ids []string) []StoredMessage {
+	list := make([]StoredMessage, 0, len(ids))
+	if len(ids) == 0 {
+		return list
+	}
+	for _, val := range client.HMGet(Messages, ids...).Val() {
+		s, ok := val.(string)
+		if !ok {
+			continue
+		}
+		var m StoredMessage
+		if json.Unmarshal([]byte(s), &m) == nil {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+// dnStatus returns the message status of a delivery notification status.
+func dnStatus(dst string) string {
+	switch dst {
+	case Buffered:
+		return StatusBuffered
+	case NotDelivered:
+		return StatusFailed
+	}
+	return StatusDelivered
+}
@@ -21,6 +21,8 @@ type ExtraService string
 const (
 	// User Data Header
 	UDH ExtraService = "01"
+	// DCS is the GSM data coding scheme of the message
+	DCS ExtraService = "02"
 	//BillingIdentifier enables the client to send additional billing information to the server
 	BillingIdentifier ExtraService = "0C"
 )
@@ -134,6 +136,20 @@ func (submit *Submit) GetRecipient() string {
 	return string(submit.AdC[:])
 }
 
+// GetOriginator returns the originator of the message, decoding alphanumeric addresses
+func (submit *Submit) GetOriginator() string {
+	const alphanumeric = "5039"
+	if string(submit.OTOA) != alphanumeric {
+		return string(submit.OAdC)
+	}
+	decoded, err := hex.DecodeString(string(submit.OAdC))
+	if err != nil || len(decoded) < 1 {
+		return string(submit.OAdC)
+	}
+	src, _ := charset.Decode7Bit(charset.Unpack7Bit(decoded[1:]))
+	return src
+}
+
 // IsNotifRequested returns true if a delivery notification is requested
 func (submit *Submit) IsNotifRequested() bool {
 	return string(submit.NT) == "1"
@@ -148,7 +164,7 @@ func (submit *Submit) GetSCTS() string {
 func (a *Submit) Result() []byte {
 	b := make([]byte, 0)
 	b = append(b, STX)
-	message := string(a.AdC[:]) + ":" + time.Now().Format("020106150405")
+	message := string(a.AdC[:]) + ":" + string(a.SCTS)
 	Len := 20 + len(message)
 	partial := [][]byte{
 		a.pdu.TransRefNum,
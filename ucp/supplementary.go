@@ -0,0 +1,177 @@
+package ucp
+
+import (
+	"bytes"
+	"strconv"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// Supplementary services of a Supplementary Services Call Input
+const (
+	Repetition       = "repetition"
+	Priority         = "priority"
+	Urgent           = "urgent"
+	ReverseCharging  = "reverse_charging"
+	DeferredDelivery = "deferred_delivery"
+)
+
+// SupplementaryCallInput is a Call Input with Supplementary Services Operation(03).
+type SupplementaryCallInput struct {
+	pdu  *PDU
+	AdC  []byte
+	OAdC []byte
+	AC   []byte
+	NPL  []byte
+	GAs  [][]byte
+	RP   []byte
+	PR   []byte
+	LPR  []byte
+	UR   []byte
+	LUR  []byte
+	RC   []byte
+	LRC  []byte
+	DD   []byte
+	DDT  []byte
+	MT   []byte
+	Msg  []byte
+}
+
+// NewSupplementaryCallInput creates a new Call Input with Supplementary Services Operation PDU.
+func NewSupplementaryCallInput(pdu *PDU) *SupplementaryCallInput {
+	b := bytes.Split(pdu.Data, []byte("/"))
+	for len(b) < 15 {
+		b = append(b, []byte{})
+	}
+	npl, _ := strconv.Atoi(string(b[3]))
+	if npl < 0 || npl > len(b)-15 || npl == 0 {
+		npl = len(b) - 15
+	}
+	rest := b[4+npl:]
+	return &SupplementaryCallInput{
+		pdu:  pdu,
+		AdC:  b[0],
+		OAdC: b[1],
+		AC:   b[2],
+		NPL:  b[3],
+		GAs:  b[4 : 4+npl],
+		RP:   rest[0],
+		PR:   rest[1],
+		LPR:  rest[2],
+		UR:   rest[3],
+		LUR:  rest[4],
+		RC:   rest[5],
+		LRC:  rest[6],
+		DD:   rest[7],
+		DDT:  rest[8],
+		MT:   rest[9],
+		Msg:  rest[10],
+	}
+}
+
+// GetMessage returns the decoded message
+func (s *SupplementaryCallInput) GetMessage() string {
+	return callInputMessage(s.MT, s.Msg)
+}
+
+// services returns the supplementary services requested by the operation, in the order of their fields.
+func (s *SupplementaryCallInput) services() []string {
+	requested := make([]string, 0)
+	for _, f := range []struct {
+		service string
+		flag    []byte
+	}{
+		{Repetition, s.RP},
+		{Priority, s.PR},
+		{Urgent, s.UR},
+		{ReverseCharging, s.RC},
+		{DeferredDelivery, s.DD},
+	} {
+		if string(f.flag) == "1" {
+			requested = append(requested, f.service)
+		}
+	}
+	return requested
+}
+
+// validate returns the error code of an invalid or barred operation, or an empty string.
+func (s *SupplementaryCallInput) validate(conf util.Profile) ErrorCode {
+	notAllowed := map[string]ErrorCode{
+		Repetition:       RepetitionNotAllowed,
+		Priority:         PriorityNotAllowed,
+		Urgent:           UrgentNotAllowed,
+		ReverseCharging:  ReverseNotAllowed,
+		DeferredDelivery: DeferredNotAllowed,
+	}
+	for _, flag := range [][]byte{s.RP, s.PR, s.UR, s.RC, s.DD} {
+		switch string(flag) {
+		case "", "0", "1":
+		default:
+			return SyntaxError
+		}
+	}
+	npl, err := strconv.Atoi(string(s.NPL))
+	if len(s.NPL) > 0 && (err != nil || (npl > 0 && npl != len(s.GAs))) {
+		return SyntaxError
+	}
+	for _, service := range s.services() {
+		for _, barred := range conf.BarredServices {
+			if service == barred {
+				return notAllowed[service]
+			}
+		}
+	}
+	if _, err := s.deliveryTime(); err != nil {
+		return TimePeriodNotValid
+	}
+	return checkCallInput(s.MT, s.Msg)
+}
+
+// deliveryTime returns the deferred delivery time, or the zero time if delivery is not deferred.
+func (s *SupplementaryCallInput) deliveryTime() (time.Time, error) {
+	return deferredTime(s.DD, s.DDT)
+}
+
+// handle accepts the message and returns the result.
+func (s *SupplementaryCallInput) handle(conf util.Profile) []byte {
+	pdu := s.pdu
+	if throttled(conf, pdu.conn.Account()) {
+		return pdu.Nack(throttleError(conf))
+	}
+	if code := s.validate(conf); code != "" {
+		return pdu.Nack(code)
+	}
+	recipient := string(s.AdC)
+	if code := acceptRecipient(conf, pdu.conn, string(s.OAdC), recipient); code != "" {
+		return pdu.Nack(code)
+	}
+	scts := issueSCTS(recipient)
+	id := bill(conf, pdu, billable{
+		operation:  SUPPLEMENTARY_SERVICE_OP,
+		account:    pdu.conn.Account(),
+		originator: string(s.OAdC),
+		recipient:  recipient,
+		scts:       scts,
+		segments:   1,
+		message:    s.GetMessage(),
+		encoding:   GSM7,
+	})
+	if id == "" {
+		return pdu.Nack(fundsError(conf))
+	}
+	record(string(s.OAdC), recipient, s.GetMessage())
+	if conf.NotifyCallInput {
+		at, _ := s.deliveryTime()
+		go notifyAt(conf, pdu, pdu.conn, id, recipient, scts, at)
+	}
+	return pdu.result([]byte("A"), []byte(""), []byte(recipient+":"+scts))
+}
+
+// deferredTime parses a deferred delivery time in DDMMYYHHmm format if deferred delivery is requested.
+func deferredTime(dd, ddt []byte) (time.Time, error) {
+	if string(dd) != "1" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("0201061504", string(ddt), time.Local)
+}
@@ -0,0 +1,36 @@
+package ucp
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestSupplementaryBarredService(t *testing.T) {
+	all := []string{Repetition, Priority, Urgent, ReverseCharging, DeferredDelivery}
+	tests := []struct {
+		name   string
+		barred []string
+		code   ErrorCode
+	}{
+		{"none barred", nil, ""},
+		{"first field barred", all, RepetitionNotAllowed},
+		{"later fields barred", []string{DeferredDelivery, Urgent, ReverseCharging}, UrgentNotAllowed},
+		{"last field barred", []string{DeferredDelivery}, DeferredNotAllowed},
+	}
+	s := &SupplementaryCallInput{RP: []byte("1"), PR: []byte("1"), UR: []byte("1"), RC: []byte("1"), DD: []byte("1"),
+		DDT: []byte("0101301200"), MT: []byte("3"), Msg: []byte("41")}
+	if got := s.services(); !reflect.DeepEqual(got, all) {
+		t.Fatalf("services() = %v, want %v", got, all)
+	}
+	for _, tt := range tests {
+		// the result must not depend on iteration order
+		for i := 0; i < 20; i++ {
+			if got := s.validate(util.Profile{BarredServices: tt.barred}); got != tt.code {
+				t.Errorf("%s: validate() = %q, want %q", tt.name, got, tt.code)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package ucp
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// bucket is a token bucket refilled at rate tokens per second up to its burst size.
+type bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(rate float64, burst int) *bucket {
+	size := math.Max(float64(burst), 1)
+	return &bucket{
+		rate:   rate,
+		burst:  size,
+		tokens: size,
+		last:   time.Now(),
+	}
+}
+
+// take removes a token from the bucket, returning false if it is empty.
+func (b *bucket) take() bool {
+	if b == nil || b.rate <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	now := time.Now()
+	b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// refund puts back a token taken from the bucket.
+func (b *bucket) refund() {
+	if b == nil || b.rate <= 0 {
+		return
+	}
+	b.mu.Lock()
+	b.tokens = math.Min(b.burst, b.tokens+1)
+	b.mu.Unlock()
+}
+
+var buckets = struct {
+	sync.Mutex
+	profile map[string]*bucket
+	account map[string]*bucket
+}{
+	profile: make(map[string]*bucket),
+	account: make(map[string]*bucket),
+}
+
+// throttled returns true if a submit of the account exceeds its rate limit or the one of the profile.
+func throttled(conf util.Profile, account string) bool {
+	buckets.Lock()
+	global, ok := buckets.profile[conf.Name]
+	if !ok {
+		global = newBucket(conf.TPS, conf.Burst)
+		buckets.profile[conf.Name] = global
+	}
+	key := conf.Name + "/" + account
+	b, ok := buckets.account[key]
+	if !ok {
+		acc, _ := conf.Account(account)
+		b = newBucket(acc.TPS, acc.Burst)
+		buckets.account[key] = b
+	}
+	buckets.Unlock()
+	if !b.take() {
+		return true
+	}
+	// a submit rejected by the profile does not count against the account
+	if !global.take() {
+		b.refund()
+		return true
+	}
+	return false
+}
+
+// throttleError returns the configured error code for throttled submits.
+func throttleError(conf util.Profile) ErrorCode {
+	if conf.ThrottleError == "" {
+		return OperationNotAllowed
+	}
+	return ErrorCode(conf.ThrottleError)
+}
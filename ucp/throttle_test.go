@@ -0,0 +1,90 @@
+package ucp
+
+import (
+	"testing"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestBucketTake(t *testing.T) {
+	tests := []struct {
+		name   string
+		bucket *bucket
+		takes  int
+		want   int
+	}{
+		{"nil", nil, 10, 10},
+		{"unlimited", newBucket(0, 0), 10, 10},
+		{"burst", newBucket(1, 3), 10, 3},
+		{"burst defaults to 1", newBucket(1, 0), 10, 1},
+	}
+	for _, tt := range tests {
+		got := 0
+		for i := 0; i < tt.takes; i++ {
+			if tt.bucket.take() {
+				got++
+			}
+		}
+		if got != tt.want {
+			t.Errorf("%s: %d of %d takes succeeded, want %d", tt.name, got, tt.takes, tt.want)
+		}
+	}
+}
+
+func TestThrottled(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile util.Profile
+		submits map[string]int
+		want    map[string]int
+	}{
+		{
+			name:    "unlimited",
+			profile: util.Profile{Name: "unlimited", Accounts: []util.Account{{User: "a"}}},
+			submits: map[string]int{"a": 10},
+			want:    map[string]int{"a": 10},
+		},
+		{
+			name:    "account limit",
+			profile: util.Profile{Name: "account", Accounts: []util.Account{{User: "a", TPS: 1, Burst: 2}, {User: "b"}}},
+			submits: map[string]int{"a": 5, "b": 5},
+			want:    map[string]int{"a": 2, "b": 5},
+		},
+		{
+			name:    "profile limit",
+			profile: util.Profile{Name: "profile", TPS: 1, Burst: 3, Accounts: []util.Account{{User: "a"}, {User: "b"}}},
+			submits: map[string]int{"a": 2, "b": 2},
+			want:    map[string]int{"a": 2, "b": 1},
+		},
+	}
+	for _, tt := range tests {
+		for _, account := range []string{"a", "b"} {
+			got := 0
+			for i := 0; i < tt.submits[account]; i++ {
+				if !throttled(tt.profile, account) {
+					got++
+				}
+			}
+			if got != tt.want[account] {
+				t.Errorf("%s: %d of %d submits of %s accepted, want %d", tt.name, got, tt.submits[account], account, tt.want[account])
+			}
+		}
+	}
+}
+
+func TestThrottledRefundsAccount(t *testing.T) {
+	conf := util.Profile{Name: "refund", TPS: 1, Burst: 1, Accounts: []util.Account{{User: "a", TPS: 1, Burst: 2}}}
+	if throttled(conf, "a") {
+		t.Fatal("first submit throttled")
+	}
+	// rejected by the profile, the account keeps its token
+	if !throttled(conf, "a") {
+		t.Fatal("second submit not throttled by the profile")
+	}
+	buckets.Lock()
+	b := buckets.account["refund/a"]
+	buckets.Unlock()
+	if !b.take() {
+		t.Error("account token consumed by a submit the profile rejected")
+	}
+}
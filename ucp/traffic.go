@@ -0,0 +1,244 @@
+package ucp
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Traffic directions
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// defaultTrafficLogSize is the number of frames kept in the traffic log if not configured
+const defaultTrafficLogSize = 10000
+
+// TrafficField is a named field of a logged frame.
+type TrafficField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// TrafficEntry is a frame received from or sent to a client.
+type TrafficEntry struct {
+	// Seq numbers the frames in the order they were logged
+	Seq        int64     `json:"seq"`
+	Time       time.Time `json:"time"`
+	Direction  string    `json:"direction"`
+	Session    string    `json:"session"`
+	Profile    string    `json:"profile"`
+	Account    string    `json:"account"`
+	RemoteAddr string    `json:"remote_addr"`
+	TRN        string    `json:"trn"`
+	// Type is O for an operation or R for a result
+	Type      string         `json:"type"`
+	Operation string         `json:"operation"`
+	Fields    []TrafficField `json:"fields"`
+	// Text is the decoded message, if the frame carries one
+	Text  string `json:"text,omitempty"`
+	Frame string `json:"frame"`
+}
+
+// TrafficFilter selects logged frames. Empty fields match all frames.
+type TrafficFilter struct {
+	Session   string
+	Account   string
+	Direction string
+	Operation string
+	// Contains is a substring of the frame or its decoded message
+	Contains string
+	From     time.Time
+	To       time.Time
+	Offset   int
+	// Limit is the maximum number of frames returned, all if zero
+	Limit int
+}
+
+// traffic is a ring buffer of the latest frames.
+var traffic = struct {
+	sync.Mutex
+	entries []TrafficEntry
+	// seq is the number of frames logged so far
+	seq  int64
+	size int
+}{size: defaultTrafficLogSize}
+
+// InitTrafficLog sets the number of frames kept in the traffic log and clears it.
+func InitTrafficLog(size int) {
+	if size <= 0 {
+		size = defaultTrafficLogSize
+	}
+	traffic.Lock()
+	defer traffic.Unlock()
+	traffic.size = size
+	traffic.entries = nil
+	traffic.seq = 0
+}
+
+// logFrame adds a frame read from or written to the connection to the traffic log and returns its entry.
+func logFrame(c *Conn, direction string, frame []byte) TrafficEntry {
+	e := TrafficEntry{
+		Time:      time.Now(),
+		Direction: direction,
+		Session:   c.ID,
+		Profile:   c.Profile.Name,
+		Account:   c.Account(),
+		Frame:     string(bytes.Trim(frame, "\x02\x03")),
+	}
+	if addr := c.RemoteAddr(); addr != nil {
+		e.RemoteAddr = addr.String()
+	}
+	decodeFrame(&e)
+	traffic.Lock()
+	defer traffic.Unlock()
+	e.Seq = traffic.seq + 1
+	if len(traffic.entries) < traffic.size {
+		traffic.entries = append(traffic.entries, e)
+	} else {
+		traffic.entries[traffic.seq%int64(traffic.size)] = e
+	}
+	traffic.seq++
+	return e
+}
+
+// secretFields are the fields masked in the traffic log, as the log is served without authentication.
+var secretFields = map[string]bool{"PWD": true, "NPWD": true}
+
+// secretMask replaces the value of a secret field.
+const secretMask = "****"
+
+// decodeFrame fills in the header, the named data fields and the message of a logged frame.
+// Passwords are masked in both the fields and the frame.
+func decodeFrame(e *TrafficEntry) {
+	parts := strings.Split(e.Frame, "/")
+	if len(parts) < 6 {
+		return
+	}
+	e.TRN, e.Type, e.Operation = parts[0], parts[2], parts[3]
+	data := parts[4 : len(parts)-1]
+	names := fieldNames(e.Type, e.Operation, data)
+	values := make(map[string]string, len(data))
+	masked := false
+	for i, value := range data {
+		name := strconv.Itoa(i + 1)
+		if i < len(names) {
+			name = names[i]
+		}
+		if secretFields[name] && value != "" {
+			value, data[i], masked = secretMask, secretMask, true
+		}
+		e.Fields = append(e.Fields, TrafficField{Name: name, Value: value})
+		values[name] = value
+	}
+	if masked {
+		e.Frame = strings.Join(parts, "/")
+	}
+	switch {
+	case values["AMsg"] != "":
+		e.Text = iraText(values["AMsg"])
+	case values["MT"] == "3":
+		e.Text = iraText(values["Msg"])
+	case values["MT"] == "2":
+		e.Text = values["Msg"]
+	}
+}
+
+var (
+	messageFields  = []string{"AdC", "OAdC", "AC", "NRq", "NAdC", "NT", "NPID", "LRq", "LRAd", "LPID", "DD", "DDT", "VP", "RPID", "SCTS", "Dst", "Rsn", "DSCTS", "MT", "NB", "Msg", "MMS", "PR", "DCs", "MCLs", "RPI", "CPg", "RPLy", "OTOA", "HPLMN", "Xser", "RES4", "RES5"}
+	sessionFields  = []string{"OAdC", "OTON", "ONPI", "STYP", "PWD", "NPWD", "VERS", "LAdC", "LTON", "LNPI", "OPID", "RES1"}
+	operationNames = map[string][]string{
+		CALL_INPUT_OP:            {"AdC", "OAdC", "AC", "MT", "Msg"},
+		MESSAGE_TRANSFER_OP:      {"AdC", "OAdC", "AC", "NRq", "NAdC", "NPID", "DD", "DDT", "VP", "AMsg"},
+		ALERT_OP:                 {"AdC", "PID"},
+		SUBMIT_SHORT_MESSAGE_OP:  messageFields,
+		DELIVER_SHORT_MESSAGE_OP: messageFields,
+		DELIVER_NOTIFICATION_OP:  messageFields,
+		SESSION_MANAGEMENT_OP:    sessionFields,
+		LIST_MANAGEMENT_OP:       sessionFields,
+		LIST_VERIFICATION_OP:     sessionFields,
+	}
+)
+
+// fieldNames returns the names of the data fields of an operation or result.
+func fieldNames(typ, operation string, data []string) []string {
+	if typ == "R" {
+		if len(data) > 0 && data[0] == "N" {
+			return []string{"NACK", "EC", "SM"}
+		}
+		if len(data) > 2 {
+			return []string{"ACK", "MVP", "SM"}
+		}
+		return []string{"ACK", "SM"}
+	}
+	// the address lists of operations 02 and 03 are as long as their NPL field
+	repeat := func(name string, npl string) []string {
+		n, _ := strconv.Atoi(npl)
+		list := make([]string, 0, n)
+		for i := 0; i < n; i++ {
+			list = append(list, name)
+		}
+		return list
+	}
+	switch operation {
+	case MULTIPLE_CALL_INPUT_OP:
+		if len(data) > 0 {
+			names := append([]string{"NPL"}, repeat("RAd", data[0])...)
+			return append(names, "OAdC", "AC", "MT", "Msg")
+		}
+	case SUPPLEMENTARY_SERVICE_OP:
+		if len(data) > 3 {
+			names := append([]string{"AdC", "OAdC", "AC", "NPL"}, repeat("GA", data[3])...)
+			return append(names, "RP", "PR", "LPR", "UR", "LUR", "RC", "LRC", "DD", "DDT", "MT", "Msg")
+		}
+	}
+	return operationNames[operation]
+}
+
+// iraText decodes an IRA message, or returns an empty string if it is malformed.
+func iraText(msg string) string {
+	b, err := hex.DecodeString(msg)
+	if err != nil {
+		return ""
+	}
+	for _, c := range b {
+		if int(c) >= len(gsmTable) {
+			return ""
+		}
+	}
+	return decodeIRA([]byte(msg))
+}
+
+// FindTraffic returns the logged frames matching the filter, newest first, and the number of matches.
+func FindTraffic(f TrafficFilter) ([]TrafficEntry, int) {
+	traffic.Lock()
+	defer traffic.Unlock()
+	matches := make([]TrafficEntry, 0)
+	for seq := traffic.seq - 1; seq >= 0 && seq >= traffic.seq-int64(len(traffic.entries)); seq-- {
+		e := traffic.entries[seq%int64(traffic.size)]
+		switch {
+		case f.Session != "" && e.Session != f.Session:
+		case f.Account != "" && e.Account != f.Account:
+		case f.Direction != "" && e.Direction != f.Direction:
+		case f.Operation != "" && e.Operation != f.Operation:
+		case !f.From.IsZero() && e.Time.Before(f.From):
+		case !f.To.IsZero() && !e.Time.Before(f.To):
+		case !strings.Contains(e.Frame, f.Contains) && !strings.Contains(e.Text, f.Contains):
+		default:
+			matches = append(matches, e)
+		}
+	}
+	total := len(matches)
+	if f.Offset >= total {
+		return matches[:0], total
+	}
+	matches = matches[f.Offset:]
+	if f.Limit > 0 && f.Limit < len(matches) {
+		matches = matches[:f.Limit]
+	}
+	return matches, total
+}
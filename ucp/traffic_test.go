@@ -0,0 +1,128 @@
+package ucp
+
+import (
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFieldNames(t *testing.T) {
+	tests := []struct {
+		typ, operation string
+		data           []string
+		want           []string
+	}{
+		{"R", SUBMIT_SHORT_MESSAGE_OP, []string{"A", "", "0917:191026120000"}, []string{"ACK", "MVP", "SM"}},
+		{"R", SESSION_MANAGEMENT_OP, []string{"A", "BIND AUTHENTICATED"}, []string{"ACK", "SM"}},
+		{"R", SUBMIT_SHORT_MESSAGE_OP, []string{"N", "02", "SYNTAX ERROR"}, []string{"NACK", "EC", "SM"}},
+		{"O", CALL_INPUT_OP, []string{"0917", "123", "", "3", "41"}, []string{"AdC", "OAdC", "AC", "MT", "Msg"}},
+		{"O", MULTIPLE_CALL_INPUT_OP, []string{"2", "0917", "0918", "123", "", "3", "41"}, []string{"NPL", "RAd", "RAd", "OAdC", "AC", "MT", "Msg"}},
+		{"O", MULTIPLE_CALL_INPUT_OP, []string{"x"}, []string{"NPL", "OAdC", "AC", "MT", "Msg"}},
+		{"O", SUPPLEMENTARY_SERVICE_OP, []string{"0917", "123", "", "1", "G1"}, []string{"AdC", "OAdC", "AC", "NPL", "GA", "RP", "PR", "LPR", "UR", "LUR", "RC", "LRC", "DD", "DDT", "MT", "Msg"}},
+		{"O", "99", []string{"a"}, nil},
+	}
+	for _, tt := range tests {
+		if got := fieldNames(tt.typ, tt.operation, tt.data); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("fieldNames(%s, %s, %v) = %v, want %v", tt.typ, tt.operation, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeFrame(t *testing.T) {
+	tests := []struct {
+		frame  string
+		trn    string
+		fields []TrafficField
+		text   string
+	}{
+		{"01/00035/O/01/0917/123//3/4849/A5", "01",
+			[]TrafficField{{"AdC", "0917"}, {"OAdC", "123"}, {"AC", ""}, {"MT", "3"}, {"Msg", "4849"}}, "HI"},
+		{"02/00032/O/01/0917/123//2/1234/96", "02",
+			[]TrafficField{{"AdC", "0917"}, {"OAdC", "123"}, {"AC", ""}, {"MT", "2"}, {"Msg", "1234"}}, "1234"},
+		{"03/00030/R/01/N/02/SYNTAX ERROR/2B", "03",
+			[]TrafficField{{"NACK", "N"}, {"EC", "02"}, {"SM", "SYNTAX ERROR"}}, ""},
+		{"04/00023/O/31/0917/0539/extra/B0", "04",
+			[]TrafficField{{"AdC", "0917"}, {"PID", "0539"}, {"3", "extra"}}, ""},
+		{"05/00040/O/01/0917/123//3/ZZ/A5", "05",
+			[]TrafficField{{"AdC", "0917"}, {"OAdC", "123"}, {"AC", ""}, {"MT", "3"}, {"Msg", "ZZ"}}, ""},
+		{"06/00000/O/60/user/6/5/3/70617373/6E6577/0100//////00", "06",
+			[]TrafficField{{"OAdC", "user"}, {"OTON", "6"}, {"ONPI", "5"}, {"STYP", "3"}, {"PWD", "****"}, {"NPWD", "****"},
+				{"VERS", "0100"}, {"LAdC", ""}, {"LTON", ""}, {"LNPI", ""}, {"OPID", ""}, {"RES1", ""}}, ""},
+		{"07/00000/O/60/user/6/5/1///0100//////00", "07",
+			[]TrafficField{{"OAdC", "user"}, {"OTON", "6"}, {"ONPI", "5"}, {"STYP", "1"}, {"PWD", ""}, {"NPWD", ""},
+				{"VERS", "0100"}, {"LAdC", ""}, {"LTON", ""}, {"LNPI", ""}, {"OPID", ""}, {"RES1", ""}}, ""},
+		{"garbage", "", nil, ""},
+	}
+	for _, tt := range tests {
+		e := TrafficEntry{Frame: tt.frame}
+		decodeFrame(&e)
+		if e.TRN != tt.trn || !reflect.DeepEqual(e.Fields, tt.fields) || e.Text != tt.text {
+			t.Errorf("decodeFrame(%q) = %s %v %q, want %s %v %q", tt.frame, e.TRN, e.Fields, e.Text, tt.trn, tt.fields, tt.text)
+		}
+		if strings.Contains(e.Frame, "70617373") || strings.Contains(e.Frame, "6E6577") {
+			t.Errorf("decodeFrame(%q) left the password in the frame %q", tt.frame, e.Frame)
+		}
+	}
+}
+
+func TestFindTraffic(t *testing.T) {
+	defer InitTrafficLog(0)
+	InitTrafficLog(4)
+	server, client := net.Pipe()
+	defer client.Close()
+	a, b := NewConn(server), NewConn(server)
+	a.ID, b.ID = "a", "b"
+	start := time.Now()
+	// the first two frames are overwritten by the last two
+	for i, f := range []struct {
+		conn      *Conn
+		direction string
+		frame     string
+	}{
+		{a, DirectionIn, "00/00000/O/01/0000/123//3/41/00"},
+		{a, DirectionIn, "00/00000/O/01/0000/123//3/41/00"},
+		{a, DirectionIn, "01/00000/O/01/0917/123//3/4849/00"},
+		{a, DirectionOut, "01/00000/R/01/A//0917:191026120000/00"},
+		{b, DirectionIn, "01/00000/O/31/0918/0539/00"},
+		{b, DirectionOut, "01/00000/R/31/A//0918:191026120000/00"},
+	} {
+		e := logFrame(f.conn, f.direction, []byte("\x02"+f.frame+"\x03"))
+		if e.Seq != int64(i+1) || e.Frame != f.frame {
+			t.Fatalf("logFrame() = %d %q, want %d %q", e.Seq, e.Frame, i+1, f.frame)
+		}
+	}
+	end := time.Now().Add(time.Millisecond)
+	tests := []struct {
+		name   string
+		filter TrafficFilter
+		seqs   []int64
+		total  int
+	}{
+		{"all, newest first", TrafficFilter{}, []int64{6, 5, 4, 3}, 4},
+		{"session", TrafficFilter{Session: "a"}, []int64{4, 3}, 2},
+		{"direction", TrafficFilter{Direction: DirectionOut}, []int64{6, 4}, 2},
+		{"operation", TrafficFilter{Operation: ALERT_OP}, []int64{6, 5}, 2},
+		{"contains frame", TrafficFilter{Contains: "0918:"}, []int64{6}, 1},
+		{"contains text", TrafficFilter{Contains: "HI"}, []int64{3}, 1},
+		{"from", TrafficFilter{From: end}, nil, 0},
+		{"to", TrafficFilter{To: start}, nil, 0},
+		{"time window", TrafficFilter{From: start, To: end}, []int64{6, 5, 4, 3}, 4},
+		{"page", TrafficFilter{Offset: 1, Limit: 2}, []int64{5, 4}, 4},
+		{"past the end", TrafficFilter{Offset: 4}, nil, 4},
+	}
+	for _, tt := range tests {
+		entries, total := FindTraffic(tt.filter)
+		var seqs []int64
+		for _, e := range entries {
+			seqs = append(seqs, e.Seq)
+		}
+		if !reflect.DeepEqual(seqs, tt.seqs) || total != tt.total {
+			t.Errorf("%s: FindTraffic() = %v of %d, want %v of %d", tt.name, seqs, total, tt.seqs, tt.total)
+		}
+	}
+	if entries, _ := FindTraffic(TrafficFilter{Limit: 1}); len(entries) != 1 || !strings.HasPrefix(entries[0].Frame, "01/00000/R/31") {
+		t.Errorf("FindTraffic() newest = %v", entries)
+	}
+}
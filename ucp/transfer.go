@@ -0,0 +1,115 @@
+package ucp
+
+import (
+	"bytes"
+
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+// Transfer is an SMS Message Transfer Operation(30).
+type Transfer struct {
+	pdu  *PDU
+	AdC  []byte
+	OAdC []byte
+	AC   []byte
+	NRq  []byte
+	NAdC []byte
+	NPID []byte
+	DD   []byte
+	DDT  []byte
+	VP   []byte
+	AMsg []byte
+}
+
+// NewTransfer creates a new SMS Message Transfer Operation PDU.
+func NewTransfer(pdu *PDU) *Transfer {
+	b := bytes.Split(pdu.Data, []byte("/"))
+	for len(b) < 10 {
+		b = append(b, []byte{})
+	}
+	return &Transfer{
+		pdu:  pdu,
+		AdC:  b[0],
+		OAdC: b[1],
+		AC:   b[2],
+		NRq:  b[3],
+		NAdC: b[4],
+		NPID: b[5],
+		DD:   b[6],
+		DDT:  b[7],
+		VP:   b[8],
+		AMsg: b[9],
+	}
+}
+
+// GetMessage returns the decoded message
+func (t *Transfer) GetMessage() string {
+	return decodeIRA(t.AMsg)
+}
+
+// IsNotifRequested returns true if a delivery notification is requested
+func (t *Transfer) IsNotifRequested() bool {
+	return string(t.NRq) == "1"
+}
+
+// validate returns the error code of an invalid operation, or an empty string.
+func (t *Transfer) validate() ErrorCode {
+	for _, flag := range [][]byte{t.NRq, t.DD} {
+		switch string(flag) {
+		case "", "0", "1":
+		default:
+			return SyntaxError
+		}
+	}
+	if _, err := deferredTime(t.DD, t.DDT); err != nil {
+		return TimePeriodNotValid
+	}
+	if len(t.VP) > 0 {
+		if _, err := deferredTime([]byte("1"), t.VP); err != nil {
+			return TimePeriodNotValid
+		}
+	}
+	const AMsg = "3"
+	return checkCallInput([]byte(AMsg), t.AMsg)
+}
+
+// handle accepts the message and returns the result.
+func (t *Transfer) handle(conf util.Profile) []byte {
+	pdu := t.pdu
+	if throttled(conf, pdu.conn.Account()) {
+		return pdu.Nack(throttleError(conf))
+	}
+	if code := t.validate(); code != "" {
+		return pdu.Nack(code)
+	}
+	recipient := string(t.AdC)
+	if code := acceptRecipient(conf, pdu.conn, string(t.OAdC), recipient); code != "" {
+		return pdu.Nack(code)
+	}
+	scts := issueSCTS(recipient)
+	id := bill(conf, pdu, billable{
+		operation:  MESSAGE_TRANSFER_OP,
+		account:    pdu.conn.Account(),
+		originator: string(t.OAdC),
+		recipient:  recipient,
+		scts:       scts,
+		segments:   1,
+		message:    t.GetMessage(),
+		encoding:   GSM7,
+	})
+	if id == "" {
+		return pdu.Nack(fundsError(conf))
+	}
+	record(string(t.OAdC), recipient, t.GetMessage())
+	if t.IsNotifRequested() {
+		at, _ := deferredTime(t.DD, t.DDT)
+		go notifyAt(conf, pdu, notificationConn(pdu.conn, t.NPID, t.NAdC), id, recipient, scts, at)
+	}
+	return t.Result(scts)
+}
+
+// Result returns an SMS Message Transfer Result.
+// The modified validity period is left empty since the requested one is always accepted.
+func (t *Transfer) Result(scts string) []byte {
+	return t.pdu.result([]byte("A"), []byte(""), []byte(string(t.AdC)+":"+scts))
+}
@@ -10,12 +10,16 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/go-gsm/charset"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/jcaberio/ucp-smsc-sim/event"
+	"github.com/jcaberio/ucp-smsc-sim/server"
 	"github.com/jcaberio/ucp-smsc-sim/ucp"
 	"github.com/jcaberio/ucp-smsc-sim/util"
 	"github.com/shirou/gopsutil/process"
@@ -28,6 +32,10 @@ const (
 	pongWait = 60 * time.Second
 	// Send pings to client with this period. Must be less than pongWait.
 	pingPeriod = (pongWait * 9) / 10
+	// Publish a snapshot of the simulator state with this period.
+	snapshotPeriod = time.Second
+	// Number of messages returned by /messages
+	latestMessages = 100
 )
 
 var (
@@ -58,79 +66,84 @@ func reader(ws *websocket.Conn) {
 	}
 }
 
+// snapshot is the periodic aggregate of the simulator state sent to every viewer.
+type snapshot struct {
+	DRCount       int64
+	SMCount       int64
+	Tps           int64
+	Cost          float64
+	MemoryPercent float32
+	CpuPercent    float64
+	ClientConns   []string
+	Messages      []util.Message
+}
+
+var latest = struct {
+	sync.Mutex
+	event.Event
+}{}
+
+// publishSnapshots publishes a snapshot of the simulator state every snapshotPeriod.
+func publishSnapshots() {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	if err != nil {
+		log.Println(err)
+	}
+	for range time.Tick(snapshotPeriod) {
+		var snap snapshot
+		if proc != nil {
+			snap.MemoryPercent, _ = proc.MemoryPercent()
+			// CPU usage since the previous snapshot
+			snap.CpuPercent, _ = proc.Percent(0)
+		}
+		snap.DRCount, _ = client.HGet(ucp.CountersKey, ucp.DrField).Int64()
+		snap.SMCount, _ = client.HGet(ucp.CountersKey, ucp.SmField).Int64()
+		snap.Tps, _ = client.Get(ucp.TpsKey).Int64()
+		snap.Cost, _ = client.Get(ucp.Cost).Float64()
+		snap.ClientConns = make([]string, 0)
+		for _, s := range server.Sessions() {
+			snap.ClientConns = append(snap.ClientConns, s.Profile+" "+s.RemoteAddr+" "+s.Account+" ("+s.State+")")
+		}
+		snap.Messages = make([]util.Message, 0)
+		for _, msgStr := range client.LRange(ucp.MsgList, 0, -1).Val() {
+			var msgObj util.Message
+			json.Unmarshal([]byte(msgStr), &msgObj)
+			snap.Messages = append(snap.Messages, msgObj)
+		}
+		latest.Lock()
+		latest.Event = event.Event{Type: event.Snapshot, Time: time.Now(), Data: snap}
+		latest.Unlock()
+		event.Publish(event.Snapshot, snap)
+	}
+}
+
+// writer streams the events to the web socket, starting with the latest snapshot.
 func writer(ws *websocket.Conn) {
-	ticker := time.NewTicker(time.Millisecond * 200)
+	events, unsubscribe := event.Subscribe()
 	pingTicker := time.NewTicker(pingPeriod)
 	defer func() {
-		ticker.Stop()
+		unsubscribe()
 		pingTicker.Stop()
 		ws.Close()
 	}()
+	latest.Lock()
+	first := latest.Event
+	latest.Unlock()
+	if first.Type != "" {
+		ws.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := ws.WriteJSON(first); err != nil {
+			log.Println("Error in writing snapshot to web socket")
+			return
+		}
+	}
 	for {
 		select {
-		case <-ticker.C:
-			proc, _ := process.NewProcess(int32(os.Getpid()))
-			memoryPercent, _ := proc.MemoryPercent()
-			cpuPercent, _ := proc.Percent(1 * time.Second)
-			drCount, _ := client.HGet(ucp.CountersKey, ucp.DrField).Int64()
-			smCount, _ := client.HGet(ucp.CountersKey, ucp.SmField).Int64()
-			tps, _ := client.Get(ucp.TpsKey).Int64()
-			cost, _ := client.Get(ucp.Cost).Float64()
-			client.ZRemRangeByScore(ucp.ActiveConnection, "0", string(time.Now().Unix()))
-			nowStr := strconv.FormatInt(time.Now().Unix(), 10)
-			reqPacket := client.Get(ucp.ReqPacket).Val()
-			resPacket := client.Get(ucp.ResPacket).Val()
-			activeConns := client.ZRangeByScore(ucp.ActiveConnection,
-				redis.ZRangeBy{Min: nowStr, Max: "+inf"}).Val()
-			msgListStr := client.LRange(ucp.MsgList, 0, -1).Val()
-			msgList := make([]util.Message, 0)
-			var msgObj util.Message
-			for _, msgStr := range msgListStr {
-				json.Unmarshal([]byte(msgStr), &msgObj)
-				msgList = append(msgList, msgObj)
-			}
+		case e := <-events:
 			ws.SetWriteDeadline(time.Now().Add(writeWait))
-			if err := ws.WriteJSON(struct {
-				IncomingPackets string
-				OutgoingPackets string
-				MemoryPercent   float32
-				CpuPercent      float64
-				Cost            float64
-			}{
-				IncomingPackets: reqPacket,
-				OutgoingPackets: resPacket,
-				MemoryPercent:   memoryPercent,
-				CpuPercent:      cpuPercent,
-				Cost:            cost,
-			}); err != nil {
-				log.Println("Error in writing packets to web socket")
-				return
-			}
-			if err := ws.WriteJSON(struct {
-				Messages []util.Message
-			}{Messages: msgList}); err != nil {
-				log.Println("Error in writing latest messages to web socket")
-				return
-			}
-			if err := ws.WriteJSON(struct {
-				ClientConns []string
-			}{ClientConns: activeConns}); err != nil {
-				log.Println("Error in writing active client connections to web socket")
+			if err := ws.WriteJSON(e); err != nil {
+				log.Println("Error in writing event to web socket")
 				return
 			}
-			if err := ws.WriteJSON(struct {
-				DRCount int64
-				SMCount int64
-				Tps     int64
-			}{
-				DRCount: drCount,
-				SMCount: smCount,
-				Tps:     tps,
-			}); err != nil {
-				log.Println("Error in writing atomic counters to web socket")
-				return
-			}
-
 		case <-pingTicker.C:
 			ws.SetWriteDeadline(time.Now().Add(writeWait))
 			if err := ws.WriteMessage(websocket.PingMessage, []byte{}); err != nil {
@@ -165,54 +178,413 @@ func serveHome(w http.ResponseWriter, r *http.Request) {
 	homeTempl.Execute(w, struct{ WsPort string }{WsPort: httpAddress})
 }
 
+// messagesHandler returns the latest messages. Use /api/messages to search and page through all of them.
 func messagesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
-	msgListStr := client.LRange(ucp.MsgList, 0, -1).Val()
-	msgList := make([]util.Message, 0)
-	var msgObj util.Message
-	for _, msgStr := range msgListStr {
-		json.Unmarshal([]byte(msgStr), &msgObj)
-		msgList = append([]util.Message{msgObj}, msgList...)
+	stored, _ := ucp.FindMessages(ucp.MessageFilter{Limit: latestMessages})
+	msgList := make([]util.Message, 0, len(stored))
+	for _, m := range stored {
+		msgList = append(msgList, util.Message{Message: m.Message, Sender: m.Sender, Recipient: m.Recipient, Timestamp: m.Received.String()})
 	}
 	json.NewEncoder(w).Encode(msgList)
 }
 
-func drHandler(w http.ResponseWriter, r *http.Request) {
-	drCount, _ := client.HGet(ucp.CountersKey, ucp.DrField).Int64()
+func apiMessageHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := ucp.GetMessage(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(m)
+}
+
+// listQuery is the time window and page of a list request.
+type listQuery struct {
+	From, To      time.Time
+	Offset, Limit int
+}
+
+// parseListQuery parses the RFC 3339 from and to and the offset and limit parameters of the request,
+// with the given limit if none is set. It replies 400 and returns false if any of them is invalid.
+func parseListQuery(w http.ResponseWriter, r *http.Request, limit int) (listQuery, bool) {
+	q := r.URL.Query()
+	lq := listQuery{Limit: limit}
+	for _, p := range []struct {
+		name string
+		t    *time.Time
+	}{{"from", &lq.From}, {"to", &lq.To}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return lq, false
+			}
+			*p.t = t
+		}
+	}
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{{"offset", &lq.Offset}, {"limit", &lq.Limit}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+p.name, http.StatusBadRequest)
+				return lq, false
+			}
+			*p.n = n
+		}
+	}
+	return lq, true
+}
+
+func apiMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := ucp.MessageFilter{
+		Recipient: q.Get("recipient"),
+		Sender:    q.Get("sender"),
+		Contains:  q.Get("contains"),
+		Status:    q.Get("status"),
+	}
+	lq, ok := parseListQuery(w, r, 100)
+	if !ok {
+		return
+	}
+	filter.From, filter.To, filter.Offset, filter.Limit = lq.From, lq.To, lq.Offset, lq.Limit
+	messages, total := ucp.FindMessages(filter)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(struct {
-		DrCount int64 `json:"deliver_sm_resp_count"`
+		Total    int                 `json:"total"`
+		Offset   int                 `json:"offset"`
+		Limit    int                 `json:"limit"`
+		Messages []ucp.StoredMessage `json:"messages"`
 	}{
-		drCount,
+		Total:    total,
+		Offset:   filter.Offset,
+		Limit:    filter.Limit,
+		Messages: messages,
 	})
 }
 
-func smHandler(w http.ResponseWriter, r *http.Request) {
-	smCount, _ := client.HGet(ucp.CountersKey, ucp.SmField).Int64()
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	ucp.WriteMetrics(w)
+	server.WriteMetrics(w)
+}
+
+func apiTrafficHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := ucp.TrafficFilter{
+		Session:   q.Get("session"),
+		Account:   q.Get("account"),
+		Direction: q.Get("direction"),
+		Operation: q.Get("operation"),
+		Contains:  q.Get("contains"),
+	}
+	lq, ok := parseListQuery(w, r, 100)
+	if !ok {
+		return
+	}
+	filter.From, filter.To, filter.Offset, filter.Limit = lq.From, lq.To, lq.Offset, lq.Limit
+	frames, total := ucp.FindTraffic(filter)
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(struct {
-		SmCount int64 `json:"submit_sm_count"`
+		Total  int                `json:"total"`
+		Offset int                `json:"offset"`
+		Limit  int                `json:"limit"`
+		Frames []ucp.TrafficEntry `json:"frames"`
 	}{
-		smCount,
+		Total:  total,
+		Offset: filter.Offset,
+		Limit:  filter.Limit,
+		Frames: frames,
 	})
 }
 
-func tpsHandler(w http.ResponseWriter, r *http.Request) {
-	tps, _ := client.Get(ucp.TpsKey).Int64()
+func resetHandler(w http.ResponseWriter, r *http.Request) {
+	client.HMSet(ucp.CountersKey, map[string]string{ucp.SmField: "0"})
+}
+
+func faultsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodPost {
+		fault := ucp.NewFault()
+		if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		fault.ID = ""
+		fault, err := ucp.AddFault(fault)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(fault)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(ucp.Faults())
+}
+
+func faultHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if r.Method == http.MethodDelete {
+		if !ucp.RemoveFault(id) {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+		return
+	}
+	fault := ucp.NewFault()
+	if err := json.NewDecoder(r.Body).Decode(&fault); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	found := false
+	for _, f := range ucp.Faults() {
+		found = found || f.ID == id
+	}
+	if !found {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	fault.ID = id
+	fault, err := ucp.AddFault(fault)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(fault)
+}
+
+func subscribersHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var s ucp.Subscriber
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		if err := ucp.AddSubscriber(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		return
+	case http.MethodPut:
+		var list []ucp.Subscriber
+		var err error
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+			list, err = ucp.ParseSubscribers(r.Body)
+		} else {
+			err = json.NewDecoder(r.Body).Decode(&list)
+		}
+		defer r.Body.Close()
+		if err == nil {
+			err = ucp.SetSubscribers(list)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(ucp.Subscribers())
+}
+
+func subscriberHandler(w http.ResponseWriter, r *http.Request) {
+	msisdn := mux.Vars(r)["msisdn"]
+	switch r.Method {
+	case http.MethodDelete:
+		if !ucp.RemoveSubscriber(msisdn) {
+			http.Error(w, "Not found", http.StatusNotFound)
+		}
+		return
+	case http.MethodPut:
+		var s ucp.Subscriber
+		if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		s.MSISDN = msisdn
+		if err := ucp.AddSubscriber(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	s, ok := ucp.GetSubscriber(msisdn)
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(s)
+}
+
+func costsHandler(w http.ResponseWriter, r *http.Request) {
+	totals := func(key string) map[string]float64 {
+		m := make(map[string]float64)
+		for field, val := range client.HGetAll(key).Val() {
+			m[field], _ = strconv.ParseFloat(val, 64)
+		}
+		return m
+	}
+	total, _ := client.Get(ucp.Cost).Float64()
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	json.NewEncoder(w).Encode(struct {
-		Tps int64 `json:"tps"`
+		Total       float64            `json:"total"`
+		Accounts    map[string]float64 `json:"accounts"`
+		Identifiers map[string]float64 `json:"identifiers"`
 	}{
-		Tps: tps,
+		Total:       total,
+		Accounts:    totals(ucp.AccountCost),
+		Identifiers: totals(ucp.IdentifierCost),
 	})
 }
 
-func resetHandler(w http.ResponseWriter, r *http.Request) {
-	client.HMSet(ucp.CountersKey, map[string]string{ucp.SmField: "0"})
+func cdrsHandler(w http.ResponseWriter, r *http.Request) {
+	lq, ok := parseListQuery(w, r, 0)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	contentType := "text/csv; charset=utf-8"
+	switch format {
+	case "", "csv":
+		format = "csv"
+	case "json":
+		contentType = "application/x-ndjson; charset=utf-8"
+	default:
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+	export := &exportWriter{ResponseWriter: w, contentType: contentType, filename: "cdr." + format}
+	if err := ucp.ExportCDRs(export, format, lq.From, lq.To); err != nil {
+		if !export.started {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		// the status is sent already, cut the download short rather than append the error to it
+		log.Println("Exporting CDRs failed: ", err)
+		return
+	}
+	export.start()
+}
+
+// exportWriter sends the headers of a download with the first write,
+// so that a failure before anything is written can still be reported as an error.
+type exportWriter struct {
+	http.ResponseWriter
+	contentType string
+	filename    string
+	started     bool
+}
+
+// start sets the headers of the download unless they are set already.
+func (w *exportWriter) start() {
+	if w.started {
+		return
+	}
+	w.started = true
+	w.Header().Set("Content-Type", w.contentType)
+	w.Header().Set("Content-Disposition", "attachment; filename="+w.filename)
 }
 
-func timeoutHandler(w http.ResponseWriter, r *http.Request) {
-	ucp.SetKeepAliveTimeout(60)
+func (w *exportWriter) Write(b []byte) (int, error) {
+	w.start()
+	return w.ResponseWriter.Write(b)
+}
+
+func balancesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(ucp.Balances())
+}
+
+func balanceHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	b, ok := ucp.Balance(vars["profile"], vars["account"])
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPut {
+		var req struct {
+			LowBalance float64 `json:"low_balance"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer r.Body.Close()
+		var err error
+		if b, err = ucp.SetLowBalance(vars["profile"], vars["account"], req.LowBalance); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(b)
+}
+
+func topUpHandler(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	if _, ok := ucp.Balance(vars["profile"], vars["account"]); !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	var req struct {
+		Amount float64 `json:"amount"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	b, err := ucp.TopUp(vars["profile"], vars["account"], req.Amount)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(b)
+}
+
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(server.Sessions())
+}
+
+func sessionHandler(w http.ResponseWriter, r *http.Request) {
+	s, ok := server.Session(mux.Vars(r)["id"])
+	if !ok {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(s)
+}
+
+func chaosHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Action server.Chaos `json:"action"`
+		// Duration of a stall in milliseconds
+		Duration int `json:"duration"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+	d := time.Duration(req.Duration) * time.Millisecond
+	if err := server.Disrupt(mux.Vars(r)["id"], req.Action, d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
 }
 
 func deliverSmHandler(w http.ResponseWriter, r *http.Request) {
@@ -252,38 +624,49 @@ func deliverSmHandler(w http.ResponseWriter, r *http.Request) {
 // Render displays the web UI.
 func Render(conf util.Config) {
 	httpAddress = conf.HttpAddr
-	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM, syscall.SIGUSR1, syscall.SIGUSR2)
+	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		for {
 			sigc := <-sigChan
 			switch sigc {
 			case os.Interrupt, syscall.SIGTERM:
 				log.Println("Deleting redis keys")
-				client.Del(ucp.CountersKey, ucp.ActiveConnection, ucp.ReqPacket,
-					ucp.ResPacket, ucp.MsgList, ucp.TpsKey, ucp.RefNum, ucp.Cost, ucp.IpSrcDstMsg)
+				client.Del(ucp.CountersKey, ucp.ReqPacket,
+					ucp.ResPacket, ucp.MsgList, ucp.TpsKey, ucp.RefNum, ucp.Cost, ucp.AccountCost, ucp.IdentifierCost, ucp.IpSrcDstMsg)
+				if conf.ClearMessages {
+					log.Println("Deleting stored messages")
+					ucp.ClearMessages()
+				}
 				log.Println("Exit")
 				os.Exit(0)
-			case syscall.SIGUSR1:
-				log.Println("sleeping for 30 seconds on keepalive")
-				ucp.SetKeepAliveTimeout(60)
-			case syscall.SIGUSR2:
-				log.Println("Reset keepalive sleep to 0")
-				ucp.SetKeepAliveTimeout(0)
 			}
 		}
 
 	}()
+	go publishSnapshots()
 	r := mux.NewRouter()
 	attachProfiler(r)
 	r.HandleFunc("/", serveHome)
 	r.HandleFunc("/ws", serveWs)
-	r.HandleFunc("/deliver_sm_resp_count", drHandler)
-	r.HandleFunc("/submit_sm_count", smHandler)
+	r.HandleFunc("/metrics", metricsHandler).Methods("GET")
 	r.HandleFunc("/messages", messagesHandler)
-	r.HandleFunc("/tps", tpsHandler)
+	r.HandleFunc("/api/messages", apiMessagesHandler).Methods("GET")
+	r.HandleFunc("/api/messages/{id}", apiMessageHandler).Methods("GET")
+	r.HandleFunc("/api/traffic", apiTrafficHandler).Methods("GET")
 	r.HandleFunc("/mo", deliverSmHandler)
 	r.HandleFunc("/resetHandler", resetHandler)
-	r.HandleFunc("/timeoutHandler", timeoutHandler)
+	r.HandleFunc("/faults", faultsHandler).Methods("GET", "POST")
+	r.HandleFunc("/faults/{id}", faultHandler).Methods("PUT", "DELETE")
+	r.HandleFunc("/costs", costsHandler).Methods("GET")
+	r.HandleFunc("/cdrs", cdrsHandler).Methods("GET")
+	r.HandleFunc("/balances", balancesHandler).Methods("GET")
+	r.HandleFunc("/balances/{profile}/{account}", balanceHandler).Methods("GET", "PUT")
+	r.HandleFunc("/balances/{profile}/{account}/topup", topUpHandler).Methods("POST")
+	r.HandleFunc("/subscribers", subscribersHandler).Methods("GET", "POST", "PUT")
+	r.HandleFunc("/subscribers/{msisdn}", subscriberHandler).Methods("GET", "PUT", "DELETE")
+	r.HandleFunc("/sessions", sessionsHandler).Methods("GET")
+	r.HandleFunc("/sessions/{id}", sessionHandler).Methods("GET")
+	r.HandleFunc("/sessions/{id}/chaos", chaosHandler).Methods("POST")
 	srv := &http.Server{
 		Addr:    httpAddress,
 		Handler: r,
@@ -342,13 +725,6 @@ const htmlTemplate = `<!DOCTYPE html>
                 <button type="submit" class="btn btn-warning">Reset</button>
       </form>
       </div>
- 
-      <div  class="form-group">
-      <br>
-	    <form method="post" action="/timeoutHandler" id="timeoutHandler">
-                <button type="submit" class="btn btn-warning">TImeout</button>
-      </form>
-      </div>
     </div>
 
     <h4>Active Clients</h4>
@@ -370,8 +746,48 @@ const htmlTemplate = `<!DOCTYPE html>
 		<tbody></tbody>
 	</table>
 
+	<button class="btn btn-info" data-toggle="collapse" data-target="#event-log">View events</button>
+	<div id="event-log" class="collapse"><ul id="events" class="list-group"></ul></div>
+    <hr>
 	<button class="btn btn-info" data-toggle="collapse" data-target="#packets">View packets</button>
 	<div id="packets" class="collapse">Request<pre id="req-packet"></pre>Response<pre id="res-packet"></pre></div>
+    <hr>
+	<button class="btn btn-info" data-toggle="collapse" data-target="#traffic">View traffic</button>
+	<div id="traffic" class="collapse">
+		<br>
+		<form id="traffic-filter" class="form-inline">
+			<input id="traffic-session" class="form-control" placeholder="session">
+			<input id="traffic-account" class="form-control" placeholder="account">
+			<select id="traffic-direction" class="form-control">
+				<option value="">in and out</option>
+				<option value="in">in</option>
+				<option value="out">out</option>
+			</select>
+			<input id="traffic-operation" class="form-control" placeholder="operation">
+			<input id="traffic-contains" class="form-control" placeholder="search">
+			<input id="traffic-from" type="datetime-local" step="1" class="form-control" title="from">
+			<input id="traffic-to" type="datetime-local" step="1" class="form-control" title="to">
+			<button type="submit" class="btn btn-default">Filter</button>
+			<button id="traffic-prev" type="button" class="btn btn-default">&laquo;</button>
+			<button id="traffic-next" type="button" class="btn btn-default">&raquo;</button>
+			<span id="traffic-page"></span>
+		</form>
+		<table id="traffic-frames" class="table table-condensed table-hover">
+			<thead>
+			<tr>
+			<th>time</th>
+			<th>dir</th>
+			<th>session</th>
+			<th>account</th>
+			<th>TRN</th>
+			<th>O/R</th>
+			<th>OT</th>
+			<th>message</th>
+			</tr>
+			</thead>
+			<tbody></tbody>
+		</table>
+	</div>
     <hr>
 	<button class="btn btn-info" data-toggle="collapse" data-target="#utilization">View utilization</button>
 	<div id="utilization" class="collapse">
@@ -388,49 +804,109 @@ CPU: <span id="util-stats-cpu"></span>%</pre>
             console.log("Connection closed");
         }
 		conn.onmessage = function(evt) {
-			var dr  = $("#dr_count");
-			var sm  = $("#sm_count");
-			var tps = $("#tps");
-			var cost = $("#cost");
-			var reqpackets = $("#req-packet");
-			var respackets = $("#res-packet");
-			var memory = $("#util-stats-memory");
-			var cpu = $("#util-stats-cpu");
-			dr.text(JSON.parse(evt.data).DRCount);
-			sm.text(JSON.parse(evt.data).SMCount);
-			tps.text(JSON.parse(evt.data).Tps);
-			cost.text(JSON.parse(evt.data).Cost);
-			reqpackets.text(JSON.parse(evt.data).IncomingPackets);
-			respackets.text(JSON.parse(evt.data).OutgoingPackets);
-			memory.text(JSON.parse(evt.data).MemoryPercent);
-			cpu.text(JSON.parse(evt.data).CpuPercent);
-			var elems = JSON.parse(evt.data).Messages;		
+			var e = JSON.parse(evt.data);
+			switch (e.type) {
+			case "snapshot":
+				showSnapshot(e.data);
+				break;
+			case "frame_received":
+				$("#req-packet").text(e.data.frame);
+				break;
+			case "frame_sent":
+				$("#res-packet").text(e.data.frame);
+				break;
+			case "message_accepted":
+				var tr = $('<tr>');
+				$.each([e.data.sender, e.data.recipient, e.data.message, e.time], function(i, val) {
+					$('<td>').text(val).appendTo(tr);
+				});
+				$('#arrmsg tbody').prepend(tr).children().slice(10).remove();
+				break;
+			}
+			if (e.type != "snapshot") {
+				$('<li class="list-group-item">').text(e.time + " " + e.type + " " + JSON.stringify(e.data)).prependTo("#events");
+				$("#events").children().slice(20).remove();
+			}
+		}
+
+		function showSnapshot(snap) {
+			$("#dr_count").text(snap.DRCount);
+			$("#sm_count").text(snap.SMCount);
+			$("#tps").text(snap.Tps);
+			$("#cost").text(snap.Cost);
+			$("#util-stats-memory").text(snap.MemoryPercent);
+			$("#util-stats-cpu").text(snap.CpuPercent);
+			var elems = snap.Messages;
 			if(elems !== undefined && elems.length > 0) {
 				var tbody = $('#arrmsg tbody');
 				tbody.empty();
     			var props = ["sender", "recipient", "message", "timestamp"];
-    			$.each(elems, function(i, elem) {
+    			$.each(elems.reverse(), function(i, elem) {
       				var tr = $('<tr>');
       				$.each(props, function(i, prop) {
-        				$('<td>').html(elem[prop]).appendTo(tr);
+        				$('<td>').text(elem[prop]).appendTo(tr);
       				});
       				tbody.append(tr);
     			});
 			}
-			var clientConns = JSON.parse(evt.data).ClientConns;
-			if(clientConns !== undefined && clientConns.length > 0) {
-				var clientConnList = $("#client-conns");
-				var parent = clientConnList.parent();
-				clientConnList.detach().empty().each(function(i){
-    				for (var x = 0; x < clientConns.length; x++){
-        				$(this).append('<li class="list-group-item">' + clientConns[x] + '</li>');
-						if (x == clientConns.length - 1){
-            				$(this).appendTo(parent);
-        				}
-    				}
+			var clientConnList = $("#client-conns");
+			clientConnList.empty();
+			$.each(snap.ClientConns, function(i, clientConn) {
+				$('<li class="list-group-item">').text(clientConn).appendTo(clientConnList);
+			});
+		}
+
+		var trafficOffset = 0, trafficLimit = 50, trafficTotal = 0;
+		// trafficTime returns the local time of the input in RFC 3339, or an empty string
+		function trafficTime(input) {
+			var val = $(input).val();
+			return val ? new Date(val).toISOString() : "";
+		}
+		function loadTraffic() {
+			$.getJSON("/api/traffic", {
+				session: $("#traffic-session").val(),
+				account: $("#traffic-account").val(),
+				direction: $("#traffic-direction").val(),
+				operation: $("#traffic-operation").val(),
+				contains: $("#traffic-contains").val(),
+				from: trafficTime("#traffic-from"),
+				to: trafficTime("#traffic-to"),
+				offset: trafficOffset,
+				limit: trafficLimit
+			}, function(res) {
+				var tbody = $("#traffic-frames tbody");
+				tbody.empty();
+				$.each(res.frames, function(i, f) {
+					var tr = $('<tr>').css("cursor", "pointer");
+					$.each([f.time, f.direction, f.session, f.account, f.trn, f.type, f.operation, f.text || ""], function(i, val) {
+						$('<td>').text(val).appendTo(tr);
+					});
+					var fields = $.map(f.fields || [], function(field) { return field.name + ": " + field.value; });
+					var detail = $('<tr>').hide().append($('<td colspan="8">').append($('<pre>').text(f.frame + "\n\n" + fields.join("\n"))));
+					tr.click(function() { detail.toggle(); });
+					tbody.append(tr, detail);
 				});
-			}
+				trafficTotal = res.total;
+				var last = Math.min(res.offset + res.frames.length, res.total);
+				$("#traffic-page").text((res.total ? res.offset + 1 : 0) + "-" + last + " of " + res.total);
+			});
 		}
+		$("#traffic-filter").submit(function(e) {
+			e.preventDefault();
+			trafficOffset = 0;
+			loadTraffic();
+		});
+		$("#traffic-prev").click(function() {
+			trafficOffset = Math.max(0, trafficOffset - trafficLimit);
+			loadTraffic();
+		});
+		$("#traffic-next").click(function() {
+			if (trafficOffset + trafficLimit < trafficTotal) {
+				trafficOffset += trafficLimit;
+				loadTraffic();
+			}
+		});
+		$("#traffic").on("show.bs.collapse", loadTraffic);
 
     $('#resetHandler').submit(function(e){
 			e.preventDefault();
@@ -443,18 +919,6 @@ CPU: <span id="util-stats-cpu"></span>%</pre>
 			});
 		});
 
-
-     $('#timeoutHandler').submit(function(e){
-			e.preventDefault();
-			$.ajax({
-				url:"/timeoutHandler",
-				type:"post",
-				success:function(){
-					alert("Simulate keepalive timeout");
-				}
-			});
-		});
-
 	})();
 	</script>
 </html>`
@@ -0,0 +1,100 @@
+package ui
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jcaberio/ucp-smsc-sim/ucp"
+	"github.com/jcaberio/ucp-smsc-sim/util"
+)
+
+func TestCDRsHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cdr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]string{
+		"cdr-20261019T0100.json": `{"time":"2026-10-19T01:00:00Z","type":"submit","adc":"0917"}` + "\n",
+		"cdr-20261019T0200.json": "not json\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer ucp.OpenCDRs(util.CDROutput{})
+	tests := []struct {
+		name        string
+		dir         string
+		url         string
+		status      int
+		disposition string
+		body        string
+	}{
+		{"disabled", "", "/cdrs", http.StatusInternalServerError, "", "CDRs are disabled"},
+		{"invalid format", dir, "/cdrs?format=xml", http.StatusBadRequest, "", "Invalid format"},
+		{"empty", dir, "/cdrs?format=json&to=2026-10-19T00:00:00Z", http.StatusOK, "attachment; filename=cdr.json", ""},
+		{"error while streaming", dir, "/cdrs?format=json", http.StatusOK, "attachment; filename=cdr.json", `"adc":"0917"`},
+	}
+	for _, tt := range tests {
+		if err := ucp.OpenCDRs(util.CDROutput{Dir: tt.dir, Format: "json"}); err != nil {
+			t.Fatal(err)
+		}
+		w := httptest.NewRecorder()
+		cdrsHandler(w, httptest.NewRequest("GET", tt.url, nil))
+		if w.Code != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, w.Code, tt.status)
+		}
+		if got := w.Header().Get("Content-Disposition"); got != tt.disposition {
+			t.Errorf("%s: Content-Disposition = %q, want %q", tt.name, got, tt.disposition)
+		}
+		body := w.Body.String()
+		if !strings.Contains(body, tt.body) {
+			t.Errorf("%s: body = %q, want it to contain %q", tt.name, body, tt.body)
+		}
+		if strings.Contains(body, "Reading CDR file failed") {
+			t.Errorf("%s: body = %q, want no error in the download", tt.name, body)
+		}
+	}
+}
+
+func TestParseListQuery(t *testing.T) {
+	from := time.Date(2026, 10, 19, 1, 0, 0, 0, time.UTC)
+	tests := []struct {
+		query string
+		ok    bool
+		want  listQuery
+	}{
+		{"", true, listQuery{Limit: 100}},
+		{"from=2026-10-19T01:00:00Z&offset=20&limit=10", true, listQuery{From: from, Offset: 20, Limit: 10}},
+		{"to=2026-10-19T01:00:00Z&limit=0", true, listQuery{To: from}},
+		{"from=yesterday", false, listQuery{}},
+		{"to=2026-10-19", false, listQuery{}},
+		{"offset=-1", false, listQuery{}},
+		{"limit=ten", false, listQuery{}},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		got, ok := parseListQuery(w, httptest.NewRequest("GET", "/api/messages?"+tt.query, nil), 100)
+		if ok != tt.ok {
+			t.Errorf("parseListQuery(%q) ok = %v, want %v", tt.query, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("parseListQuery(%q) status = %d, want %d", tt.query, w.Code, http.StatusBadRequest)
+			}
+			continue
+		}
+		if !got.From.Equal(tt.want.From) || !got.To.Equal(tt.want.To) || got.Offset != tt.want.Offset || got.Limit != tt.want.Limit {
+			t.Errorf("parseListQuery(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
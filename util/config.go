@@ -2,18 +2,205 @@
 package util
 
 type Config struct {
-	// UCP username
-	User string
-	// UCP password
-	Password string
-	// UCP accesscode
-	AccessCode string
-	// UCP port
-	Port int
 	// HTTP address of the web UI
 	HttpAddr string
-	// Delivery notification delay in milliseconds
+	// UCP listeners, each emulating an operator
+	Listeners []Listener
+	// Path of a .csv or .json subscriber database
+	Subscribers string
+	// Call detail record files
+	CDR CDROutput
+	// Number of frames kept in the traffic log, defaults to 10000
+	TrafficLog int
+	// Delete the stored messages on shutdown. They are kept across restarts otherwise.
+	ClearMessages bool
+	// Hours stored messages are kept, defaults to 24
+	MessageRetention int
+}
+
+// CDROutput is where call detail records are written.
+type CDROutput struct {
+	// Directory of the CDR files, no CDRs are written if empty
+	Dir string
+	// Format is csv, or json for JSON lines. Defaults to csv.
+	Format string
+	// Minutes covered by each file, defaults to 60
+	Rotate int
+}
+
+// Listener is a UCP port together with the profile of the operator it emulates.
+type Listener struct {
+	// UCP port, plain TCP is disabled if zero
+	Port int
+	// UCP over TLS listener
+	TLS TLS
+	Profile
+}
+
+// Profile is the behaviour of an emulated operator.
+type Profile struct {
+	// Name of the profile
+	Name string
+	// UCP accounts allowed to bind
+	Accounts []Account
+	// UCP accesscode
+	AccessCode string
+	// Delivery notification delay in milliseconds, used when no delivery delay rule matches
 	DNDelay int
-	// Map of billing identifier to cost
+	// Delivery latency rules, the first matching rule applies
+	DeliveryDelays []DeliveryDelay
+	// Delivery notification texts
+	DNTemplates DNTemplates
+	// Seconds between delivery attempts of a buffered message, defaults to 60
+	RetryInterval int
+	// Seconds a buffered message is retried before it fails, defaults to 3600
+	RetryPeriod int
+	// Map of billing identifier to cost, used when no rate rule matches
 	Tariff map[string]float64
+	// Rate rules, the first matching rule prices a message segment
+	Rates []Rate
+	// Cost of messages matching neither a rate rule nor a tariff
+	DefaultRate float64
+	// Map of UCP error code to the code the operator returns instead
+	ErrorCodes map[string]string
+	// Probability in percent of a random connection fault after each operation
+	ChaosRate float64
+	// Connection faults picked at random, defaults to all of them
+	ChaosActions []string
+	// Duration in milliseconds of a random stall
+	ChaosStall int
+	// Submit rate limit of all accounts combined, unlimited if zero
+	TPS float64
+	// Number of submits allowed in a burst above TPS
+	Burst int
+	// Error code of the NACK returned to throttled submits, defaults to 04
+	ThrottleError string
+	// Seconds without an incoming operation before a session is closed, never if zero
+	IdleTimeout int
+	// Error code of the NACK returned when a prepaid account cannot pay, defaults to 04
+	FundsError string
+	// Client endpoints the server connects to for delivering MOs and DNs
+	Outbound []Outbound
+	// Send delivery notifications for call inputs (op 01, 02 and 03), which cannot request them
+	NotifyCallInput bool
+	// Supplementary services of op 03 that are rejected:
+	// "repetition", "priority", "urgent", "reverse_charging" or "deferred_delivery"
+	BarredServices []string
+	// Validation of the addresses messages are accepted for
+	AddressRules AddressRules
+}
+
+// DeliveryDelay is the delivery latency of messages matching a rule.
+type DeliveryDelay struct {
+	// Prefix limits the rule to recipients starting with this prefix
+	Prefix string
+	// Account limits the rule to messages submitted by this user
+	Account string
+	// Network limits the rule to subscribers ported to this network
+	Network string
+	Delay
+}
+
+// Rate is a tariff rule pricing a message segment.
+type Rate struct {
+	// Identifier limits the rule to messages with this XSer billing identifier
+	Identifier string
+	// Prefix limits the rule to recipients starting with this prefix
+	Prefix string
+	// MinSegments limits the rule to concatenated messages of at least this many segments
+	MinSegments int
+	// Class limits the rule to messages of this message class (MCLs)
+	Class string
+	// From and To limit the rule to a time-of-day band in HH:MM, wrapping around midnight if To is before From
+	From string
+	To   string
+	// Price of a segment
+	Price float64
+}
+
+// DNTemplates are Go text templates of delivery notification texts, empty for the default English text.
+// The templates are executed with the Recipient, SCTS, DSCTS, Status, Reason and Time of the delivery.
+type DNTemplates struct {
+	Delivered string
+	Buffered  string
+	Failed    string
+}
+
+// AddressRules restrict the recipient and originator addresses of accepted messages.
+// Invalid addresses are rejected with error 06, barred recipients with error 05.
+type AddressRules struct {
+	// Accept recipients that are not numeric
+	AllowAlphanumeric bool
+	// Minimum recipient length, defaults to 1
+	MinLen int
+	// Maximum recipient length, defaults to 16
+	MaxLen int
+	// Country code prefixes recipients must start with, any if empty
+	CountryCodes []string
+	// Barred recipient prefixes
+	Blacklist []string
+	// Allowed recipient prefixes, all if empty
+	Whitelist []string
+}
+
+// Outbound is a client endpoint the server connects to as the originator.
+type Outbound struct {
+	// Address of the client UCP listener
+	Addr string
+	// Account whose MOs and DNs are delivered on this connection
+	Account string
+	// OAdC the server authenticates with, defaults to the access code
+	User string
+	// Password the server authenticates with
+	Password string
+}
+
+// TLS is the configuration of the UCP over TLS listener.
+type TLS struct {
+	// UCP over TLS port, disabled if zero
+	Port int
+	// Path of the PEM encoded server certificate
+	Cert string
+	// Path of the PEM encoded server private key
+	Key string
+	// Path of the PEM encoded CA bundle used to verify client certificates
+	CA string
+	// Reject clients that do not present a valid certificate
+	RequireClientCert bool
+	// Bind sessions to the account named by the common name of the client certificate
+	AccountFromCert bool
+}
+
+// Account is a UCP large account.
+type Account struct {
+	// UCP username
+	User string
+	// UCP password
+	Password string
+	// Submit rate limit, unlimited if zero
+	TPS float64
+	// Number of submits allowed in a burst above TPS
+	Burst int
+	// Seconds without an incoming operation before a session is closed, overrides Profile.IdleTimeout
+	IdleTimeout int
+	// Prepaid accounts pay for messages from their balance and are refused when it is exhausted
+	Prepaid bool
+	// Initial balance of a prepaid account
+	Balance float64
+	// Balance below which a prepaid account is reported as low
+	LowBalance float64
+	// Barred recipient prefixes in addition to those of the profile
+	Blacklist []string
+	// Allowed recipient prefixes in addition to those of the profile
+	Whitelist []string
+}
+
+// Account returns the account with the given username.
+func (p Profile) Account(user string) (Account, bool) {
+	for _, a := range p.Accounts {
+		if a.User == user {
+			return a, true
+		}
+	}
+	return Account{}, false
 }
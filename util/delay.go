@@ -0,0 +1,44 @@
+package util
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Delay is a random delay in milliseconds drawn from a distribution.
+type Delay struct {
+	// Distribution is one of fixed, uniform, normal or exponential. Defaults to fixed.
+	Distribution string `json:"distribution"`
+	// Value is the fixed delay, the mean of normal and exponential, and the lower bound of uniform
+	Value int `json:"value"`
+	// Max is the upper bound of uniform and the cap of normal and exponential, if non-zero
+	Max int `json:"max"`
+	// StdDev is the standard deviation of normal
+	StdDev int `json:"stddev"`
+}
+
+// Duration draws a delay from the distribution.
+func (d Delay) Duration() time.Duration {
+	var ms float64
+	switch d.Distribution {
+	case "uniform":
+		ms = float64(d.Value)
+		if d.Max > d.Value {
+			ms += rand.Float64() * float64(d.Max-d.Value)
+		}
+	case "normal":
+		ms = rand.NormFloat64()*float64(d.StdDev) + float64(d.Value)
+	case "exponential":
+		ms = rand.ExpFloat64() * float64(d.Value)
+	default:
+		ms = float64(d.Value)
+	}
+	if d.Max > 0 {
+		ms = math.Min(ms, float64(d.Max))
+	}
+	if ms < 0 {
+		ms = 0
+	}
+	return time.Duration(ms * float64(time.Millisecond))
+}
@@ -0,0 +1,34 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDelayDuration(t *testing.T) {
+	ms := time.Millisecond
+	tests := []struct {
+		name     string
+		delay    Delay
+		min, max time.Duration
+	}{
+		{"zero", Delay{}, 0, 0},
+		{"fixed", Delay{Value: 250}, 250 * ms, 250 * ms},
+		{"fixed by name", Delay{Distribution: "fixed", Value: 250}, 250 * ms, 250 * ms},
+		{"fixed capped", Delay{Value: 250, Max: 100}, 100 * ms, 100 * ms},
+		{"uniform", Delay{Distribution: "uniform", Value: 100, Max: 200}, 100 * ms, 200 * ms},
+		{"uniform without range", Delay{Distribution: "uniform", Value: 100}, 100 * ms, 100 * ms},
+		{"normal capped", Delay{Distribution: "normal", Value: 100, StdDev: 1000, Max: 150}, 0, 150 * ms},
+		{"normal without deviation", Delay{Distribution: "normal", Value: 100}, 100 * ms, 100 * ms},
+		{"exponential capped", Delay{Distribution: "exponential", Value: 100, Max: 300}, 0, 300 * ms},
+		{"negative", Delay{Value: -10}, 0, 0},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if d := tt.delay.Duration(); d < tt.min || d > tt.max {
+				t.Errorf("%s: Duration() = %v, want between %v and %v", tt.name, d, tt.min, tt.max)
+				break
+			}
+		}
+	}
+}